@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/k33g/compose-codex/workspace"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// The arguments of the prompts and of the resource templates are completed (completion/complete):
+// the workspaces of the projects directory of the session, the templates and the SSH authentication modes.
+// mcp-go has neither a handler for completion/complete nor the completions capability,
+// so the completions are answered before the MCP server, and the capability is added to the result of initialize.
+
+const methodComplete = "completion/complete"
+
+// maxCompletionValues is the maximum number of values of a completion (MCP specification).
+const maxCompletionValues = 100
+
+// completer answers the completion requests.
+type completer struct {
+	engine   *workspace.Engine
+	defaults *toolDefaults
+}
+
+// completeParams are the parameters of completion/complete.
+// The context holds the arguments already given (2025-06-18 specification).
+type completeParams struct {
+	Ref struct {
+		Type string `json:"type"` // ref/prompt or ref/resource
+		Name string `json:"name"` // the prompt
+		URI  string `json:"uri"`  // the resource template
+	} `json:"ref"`
+	Argument struct {
+		Name  string `json:"name"`
+		Value string `json:"value"`
+	} `json:"argument"`
+	Context struct {
+		Arguments map[string]string `json:"arguments"`
+	} `json:"context"`
+}
+
+// middleware answers the completion requests, and advertises the completions in the result of initialize.
+// The other requests go to the MCP server.
+func (c *completer) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			next.ServeHTTP(w, r)
+			return
+		}
+		body, err := io.ReadAll(r.Body)
+		r.Body.Close()
+		if err != nil {
+			http.Error(w, "Failed to read the request body", http.StatusBadRequest)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		var message struct {
+			ID     json.RawMessage `json:"id"`
+			Method string          `json:"method"`
+			Params json.RawMessage `json:"params"`
+		}
+		// the batches and the invalid messages are left to the MCP server
+		if err := json.Unmarshal(body, &message); err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		switch message.Method {
+		case methodComplete:
+			if r.Header.Get(server.HeaderKeySessionID) == "" {
+				http.Error(w, "Bad Request: Mcp-Session-Id header must be provided", http.StatusBadRequest)
+				return
+			}
+			c.answer(w, r, message.ID, message.Params)
+		case string(mcp.MethodInitialize):
+			advertiseCompletions(w, r, next)
+		default:
+			next.ServeHTTP(w, r)
+		}
+	})
+}
+
+// answer writes the response of a completion request.
+func (c *completer) answer(w http.ResponseWriter, r *http.Request, id, rawParams json.RawMessage) {
+	response := map[string]any{"jsonrpc": mcp.JSONRPC_VERSION, "id": id}
+	var params completeParams
+	if err := json.Unmarshal(rawParams, &params); err != nil {
+		response["error"] = map[string]any{"code": mcp.INVALID_PARAMS, "message": fmt.Sprintf("Invalid completion parameters: %v", err)}
+	} else {
+		values := c.complete(r.Header.Get(server.HeaderKeySessionID), params)
+		var result mcp.CompleteResult
+		result.Completion.Values = values
+		result.Completion.Total = len(values)
+		if len(values) > maxCompletionValues {
+			result.Completion.Values = values[:maxCompletionValues]
+			result.Completion.HasMore = true
+		}
+		response["result"] = result
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		slog.Error(fmt.Sprintf("Failed to write the completion of %s: %v", params.Argument.Name, err))
+	}
+}
+
+// complete returns the values of an argument starting with its value.
+func (c *completer) complete(session string, params completeParams) []string {
+	var candidates []string
+	argument := params.Argument.Name
+	switch {
+	case params.Ref.Type == "ref/prompt" && params.Ref.Name == "create_workspace_from_repo" && argument == "workspace_name":
+		// a new workspace: the name of the project of the repository
+		if remote, err := workspace.ParseRemote(workspace.DefaultGitHost, params.Context.Arguments["repository"]); err == nil {
+			candidates = []string{remote.ProjectName()}
+		}
+	case params.Ref.Type == "ref/prompt" && argument == "workspace_name",
+		params.Ref.Type == "ref/resource" && strings.HasPrefix(params.Ref.URI, "codex://workspaces/") && argument == "name":
+		candidates = c.workspaces(session)
+	case params.Ref.Type == "ref/prompt" && argument == "dockerfile_name":
+		candidates, _ = c.engine.Dockerfiles()
+	case params.Ref.Type == "ref/resource" && params.Ref.URI == "codex://templates/{name}" && argument == "name":
+		candidates, _ = c.engine.Templates()
+	case params.Ref.Type == "ref/prompt" && argument == "ssh_auth":
+		candidates = []string{string(workspace.SSHAuthKey), string(workspace.SSHAuthAgent), string(workspace.SSHAuthDeployKey)}
+	}
+	values := []string{}
+	for _, candidate := range candidates {
+		if strings.HasPrefix(strings.ToLower(candidate), strings.ToLower(params.Argument.Value)) {
+			values = append(values, candidate)
+		}
+	}
+	return values
+}
+
+// workspaces returns the names of the workspaces of the projects directory of a session.
+func (c *completer) workspaces(session string) []string {
+	manifests, err := c.engine.List(c.defaults.getSession(session, "projects_directory"))
+	if err != nil {
+		return nil
+	}
+	names := make([]string, 0, len(manifests))
+	for _, manifest := range manifests {
+		names = append(names, manifest.WorkspaceName)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// advertiseCompletions adds the completions capability to the result of initialize.
+func advertiseCompletions(w http.ResponseWriter, r *http.Request, next http.Handler) {
+	recorder := &responseRecorder{header: http.Header{}, status: http.StatusOK}
+	next.ServeHTTP(recorder, r)
+	body := recorder.body.Bytes()
+	if strings.HasPrefix(recorder.header.Get("Content-Type"), "application/json") {
+		var response map[string]any
+		if err := json.Unmarshal(body, &response); err == nil {
+			if result, ok := response["result"].(map[string]any); ok {
+				if capabilities, ok := result["capabilities"].(map[string]any); ok {
+					capabilities["completions"] = map[string]any{}
+					if patched, err := json.Marshal(response); err == nil {
+						body = patched
+					}
+				}
+			}
+		}
+	}
+	for name, values := range recorder.header {
+		w.Header()[name] = values
+	}
+	w.Header().Del("Content-Length")
+	w.WriteHeader(recorder.status)
+	w.Write(body)
+}
+
+// responseRecorder keeps a response to change it before it is sent.
+type responseRecorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (r *responseRecorder) Header() http.Header {
+	return r.header
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	r.status = status
+}
+
+func (r *responseRecorder) Write(data []byte) (int, error) {
+	return r.body.Write(data)
+}
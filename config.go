@@ -0,0 +1,300 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"maps"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the configuration of the server: the defaults, overridden by the configuration file,
+// by the environment variables of the former versions (HTTP_PORT, PROJECTS_DIRECTORY, PORT_RANGE,
+// TRASH_RETENTION, <TOOL_NAME>_TIMEOUT), then by the flags of the command line.
+type Config struct {
+	ListenAddress      string            `yaml:"listen_address"`      // address of the HTTP server, :9090 by default
+	EndpointPath       string            `yaml:"endpoint_path"`       // path of the MCP endpoint, /mcp by default
+	TemplatesDirectory string            `yaml:"templates_directory"` // the *.Dockerfile and compose files overriding the embedded ones
+	ProjectsRoot       string            `yaml:"projects_root"`       // the relative projects directories are resolved against it
+	ProjectsDirectory  string            `yaml:"projects_directory"`  // default projects directory of the tools, projects by default
+	SSHDirectory       string            `yaml:"ssh_directory"`       // the SSH keys, ~/.ssh by default
+	AllowedHosts       []string          `yaml:"allowed_hosts"`       // hosts allowed in the Host and Origin headers, all by default
+	LogLevel           string            `yaml:"log_level"`           // debug, info, warn or error
+	PortRange          string            `yaml:"port_range"`          // HTTP ports of the workspaces, e.g. 8100-8199
+	TrashRetention     string            `yaml:"trash_retention"`     // how long the removed workspaces are kept, e.g. 168h
+	ToolTimeouts       map[string]string `yaml:"tool_timeouts"`       // by tool name, e.g. start_workspace: 45m (0 for no timeout)
+
+	logLevel       slog.Level
+	portRangeStart int
+	portRangeEnd   int
+	trashRetention time.Duration
+	toolTimeouts   map[string]time.Duration
+}
+
+// defaultConfigFile returns the configuration file read without the -config flag.
+func defaultConfigFile() string {
+	config, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(config, "compose-codex", "config.yaml")
+}
+
+// loadConfig reads the configuration of the server from the file given by the -config flag,
+// or else from the default configuration file when it exists, then applies the environment and the flags.
+// The relative paths of the file are relative to its directory, the other ones to the current directory.
+func loadConfig(arguments []string) (*Config, error) {
+	flags := flag.NewFlagSet("compose-codex", flag.ContinueOnError)
+	configFile := flags.String("config", "", "configuration file (default "+defaultConfigFile()+" if it exists)")
+	var overrides Config
+	flags.StringVar(&overrides.ListenAddress, "listen", "", "address of the HTTP server, e.g. :9090 or 127.0.0.1:9090")
+	flags.StringVar(&overrides.EndpointPath, "endpoint", "", "path of the MCP endpoint (default /mcp)")
+	flags.StringVar(&overrides.TemplatesDirectory, "templates", "", "directory of the *.Dockerfile and compose file templates, overriding the embedded ones (default "+defaultTemplatesDirectory()+")")
+	flags.StringVar(&overrides.ProjectsRoot, "projects-root", "", "directory against which the relative projects directories are resolved (default the current directory)")
+	flags.StringVar(&overrides.ProjectsDirectory, "projects-directory", "", "default projects directory of the tools (default projects)")
+	flags.StringVar(&overrides.SSHDirectory, "ssh-directory", "", "directory of the SSH keys (default ~/.ssh)")
+	allowedHosts := flags.String("allowed-hosts", "", "comma separated hosts allowed in the Host and Origin headers, e.g. localhost,127.0.0.1 (default all)")
+	flags.StringVar(&overrides.LogLevel, "log-level", "", "debug, info, warn or error (default info)")
+	flags.StringVar(&overrides.PortRange, "port-range", "", "HTTP ports allocated to the workspaces (default 8100-8199)")
+	flags.StringVar(&overrides.TrashRetention, "trash-retention", "", "how long the removed workspaces stay in the trash, 0 to delete them at once (default 168h)")
+	if err := flags.Parse(arguments); err != nil {
+		return nil, err
+	}
+	if *allowedHosts != "" {
+		overrides.AllowedHosts = strings.Split(*allowedHosts, ",")
+	}
+
+	config := &Config{
+		ListenAddress:      ":9090",
+		EndpointPath:       "/mcp",
+		TemplatesDirectory: defaultTemplatesDirectory(),
+		ProjectsDirectory:  "projects",
+		LogLevel:           "info",
+	}
+	path := *configFile
+	if path == "" {
+		path = defaultConfigFile()
+	}
+	if path != "" {
+		file, err := readConfigFile(path)
+		if err != nil && (*configFile != "" || !errors.Is(err, fs.ErrNotExist)) {
+			return nil, err
+		}
+		if err == nil {
+			config.override(file)
+		}
+	}
+	config.override(environmentConfig())
+	config.override(&overrides)
+	if err := config.resolve(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// readConfigFile reads a YAML configuration file.
+func readConfigFile(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var config Config
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&config); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	// the paths of the file do not depend on the directory the server is started from
+	directory := filepath.Dir(path)
+	for _, field := range []*string{&config.TemplatesDirectory, &config.ProjectsRoot, &config.SSHDirectory} {
+		if *field != "" && !filepath.IsAbs(*field) && !strings.HasPrefix(*field, "~") {
+			*field = filepath.Join(directory, *field)
+		}
+	}
+	return &config, nil
+}
+
+// environmentConfig returns the configuration given by the environment variables of the former versions.
+func environmentConfig() *Config {
+	config := &Config{
+		ProjectsDirectory: os.Getenv("PROJECTS_DIRECTORY"),
+		PortRange:         os.Getenv("PORT_RANGE"),
+		TrashRetention:    os.Getenv("TRASH_RETENTION"),
+	}
+	if port := os.Getenv("HTTP_PORT"); port != "" {
+		config.ListenAddress = ":" + port
+	}
+	for tool := range defaultToolTimeouts {
+		if timeout := os.Getenv(strings.ToUpper(tool) + "_TIMEOUT"); timeout != "" {
+			if config.ToolTimeouts == nil {
+				config.ToolTimeouts = map[string]string{}
+			}
+			config.ToolTimeouts[tool] = timeout
+		}
+	}
+	return config
+}
+
+// override sets the fields given by another configuration.
+func (c *Config) override(other *Config) {
+	for _, field := range []struct{ value, override *string }{
+		{&c.ListenAddress, &other.ListenAddress},
+		{&c.EndpointPath, &other.EndpointPath},
+		{&c.TemplatesDirectory, &other.TemplatesDirectory},
+		{&c.ProjectsRoot, &other.ProjectsRoot},
+		{&c.ProjectsDirectory, &other.ProjectsDirectory},
+		{&c.SSHDirectory, &other.SSHDirectory},
+		{&c.LogLevel, &other.LogLevel},
+		{&c.PortRange, &other.PortRange},
+		{&c.TrashRetention, &other.TrashRetention},
+	} {
+		if *field.override != "" {
+			*field.value = *field.override
+		}
+	}
+	if len(other.AllowedHosts) > 0 {
+		c.AllowedHosts = other.AllowedHosts
+	}
+	for tool, timeout := range other.ToolTimeouts {
+		if c.ToolTimeouts == nil {
+			c.ToolTimeouts = map[string]string{}
+		}
+		c.ToolTimeouts[tool] = timeout
+	}
+}
+
+// resolve checks the configuration and makes its paths absolute.
+func (c *Config) resolve() error {
+	if err := c.logLevel.UnmarshalText([]byte(c.LogLevel)); err != nil {
+		return fmt.Errorf("log_level %q: expected debug, info, warn or error", c.LogLevel)
+	}
+	if !strings.HasPrefix(c.EndpointPath, "/") {
+		return fmt.Errorf("endpoint_path %q: expected a path starting with /", c.EndpointPath)
+	}
+	if _, _, err := net.SplitHostPort(c.ListenAddress); err != nil {
+		return fmt.Errorf("listen_address %q: %v", c.ListenAddress, err)
+	}
+	if c.PortRange != "" {
+		start, end, err := parsePortRange(c.PortRange)
+		if err != nil {
+			return fmt.Errorf("port_range %q: %v", c.PortRange, err)
+		}
+		c.portRangeStart, c.portRangeEnd = start, end
+	}
+	if c.TrashRetention != "" {
+		retention, err := time.ParseDuration(c.TrashRetention)
+		if err != nil || retention < 0 {
+			return fmt.Errorf("trash_retention %q: expected a duration such as 168h", c.TrashRetention)
+		}
+		c.trashRetention = retention
+	}
+	c.toolTimeouts = maps.Clone(defaultToolTimeouts)
+	for tool, value := range c.ToolTimeouts {
+		if _, ok := defaultToolTimeouts[tool]; !ok {
+			return fmt.Errorf("tool_timeouts: %q has no timeout (expected one of %s)", tool, strings.Join(slices.Sorted(maps.Keys(defaultToolTimeouts)), ", "))
+		}
+		timeout, err := time.ParseDuration(value)
+		if err != nil || timeout < 0 {
+			return fmt.Errorf("tool_timeouts: %s %q: expected a duration such as 45m, 0 for no timeout", tool, value)
+		}
+		c.toolTimeouts[tool] = timeout
+	}
+	for i, host := range c.AllowedHosts {
+		c.AllowedHosts[i] = strings.TrimSpace(host)
+	}
+
+	for _, field := range []*string{&c.TemplatesDirectory, &c.ProjectsRoot, &c.SSHDirectory} {
+		if *field == "" {
+			continue
+		}
+		path, err := absolutePath(*field)
+		if err != nil {
+			return err
+		}
+		*field = path
+	}
+	return nil
+}
+
+// defaultTemplatesDirectory returns the directory of the user templates read without configuration.
+func defaultTemplatesDirectory() string {
+	config, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(config, "compose-codex", "templates")
+}
+
+// absolutePath expands a leading ~ to the home directory and makes a path absolute.
+func absolutePath(path string) (string, error) {
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		path = filepath.Join(home, path[1:])
+	}
+	return filepath.Abs(path)
+}
+
+// setupLogging sends the logs to the standard error with the level of the configuration.
+// The log.Printf calls are logged at the info level.
+func (c *Config) setupLogging() {
+	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: c.logLevel})))
+}
+
+// allowHosts rejects the requests whose Host header, or Origin header when they have one,
+// is not an allowed host: a web page of another site cannot reach the server with a DNS rebinding.
+// Without allowed hosts, all the hosts are allowed.
+func allowHosts(hosts []string, next http.Handler) http.Handler {
+	if len(hosts) == 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		allowed := hostAllowed(hosts, r.Host)
+		if origin := r.Header.Get("Origin"); allowed && origin != "" {
+			originURL, err := url.Parse(origin)
+			allowed = err == nil && hostAllowed(hosts, originURL.Host)
+		}
+		if !allowed {
+			slog.Warn(fmt.Sprintf("Request rejected: host %q, origin %q not allowed", r.Host, r.Header.Get("Origin")))
+			http.Error(w, "host not allowed", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// hostAllowed tells whether a host, with or without its port, is one of the allowed hosts.
+// An allowed host without port allows all the ports.
+func hostAllowed(hosts []string, hostPort string) bool {
+	host := hostPort
+	if name, _, err := net.SplitHostPort(hostPort); err == nil {
+		host = name
+	}
+	for _, allowed := range hosts {
+		if strings.EqualFold(allowed, hostPort) || strings.EqualFold(allowed, host) {
+			return true
+		}
+	}
+	return false
+}
+
+// fatalf logs an error and exits, whatever the log level.
+func fatalf(format string, args ...any) {
+	slog.Error(fmt.Sprintf(format, args...))
+	os.Exit(1)
+}
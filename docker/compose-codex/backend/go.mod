@@ -27,7 +27,7 @@ require (
 
 require (
 	github.com/labstack/gommon v0.4.2 // indirect
-	github.com/mark3labs/mcp-go v0.36.0
+	github.com/mark3labs/mcp-go v0.38.0
 	github.com/mattn/go-colorable v0.1.14 // indirect
 	github.com/mattn/go-isatty v0.0.20 // indirect
 	github.com/openai/openai-go v1.12.0
@@ -13,7 +13,7 @@ import (
 	"net"
 	"net/http"
 	"os"
-	"os/exec"
+	"strconv"
 	"strings"
 
 	"github.com/labstack/echo/v4"
@@ -95,20 +95,24 @@ func configHandler(ctx echo.Context) error {
 		return ctx.JSON(http.StatusInternalServerError, HTTPMessageBody{Message: "Failed to create MCP client"})
 	}
 
-	// Create jsonStringArguments with the specific format required (http_port as string)
+	// Create jsonStringArguments (without http_port, the server allocates the port)
 	configMap := map[string]interface{}{
 		"compose_file_name":     config.ComposeFileName,
 		"dockerfile_name":       config.DockerfileName,
 		"git_host":              config.GitHost,
+		"git_token":             config.GitToken,
 		"git_user_email":        config.GitUserEmail,
 		"git_user_name":         config.GitUserName,
-		"http_port":             fmt.Sprintf("%d", config.HTTPPort), // Convert to string
 		"key_name":              config.KeyName,
 		"offload_override_name": config.OffloadOverride,
 		"projects_directory":    config.ProjectsDirectory,
 		"repository":            config.Repository,
+		"ssh_auth":              config.SSHAuth,
 		"workspace_name":        config.WorkspaceName,
 	}
+	if config.HTTPPort != 0 {
+		configMap["http_port"] = config.HTTPPort
+	}
 
 	jsonStringArguments, err := json.Marshal(configMap)
 	if err != nil {
@@ -126,6 +130,9 @@ func configHandler(ctx echo.Context) error {
 		return ctx.JSON(http.StatusInternalServerError, HTTPMessageBody{Message: "No content returned from MCP tool"})
 	}
 
+	// Never log nor send back the git token
+	config.GitToken = ""
+
 	logger.Infof("🟢 Received config: %+v", config)
 	logger.Infof("🟠 Received toolResponse: %+v", toolResponse)
 
@@ -146,7 +153,7 @@ func startWorkspaceStreamHandler(ctx echo.Context) error {
 	repository := ctx.QueryParam("repository")
 	mcpServerURL := ctx.QueryParam("mcp_server_url")
 
-	if workspaceName == "" || projectsDirectory == "" || httpPort == "" {
+	if workspaceName == "" || projectsDirectory == "" {
 		return ctx.JSON(http.StatusBadRequest, HTTPMessageBody{Message: "Missing required parameters"})
 	}
 
@@ -178,17 +185,18 @@ func startWorkspaceStreamHandler(ctx echo.Context) error {
 			progressChan <- fmt.Sprintf("data: {\"error\": \"Failed to create MCP client: %v\"}\n\n", err)
 			return
 		}
-
-		// Send initial progress
-		progressChan <- "data: {\"progress\": 10, \"message\": \"Initializing workspace...\"}\n\n"
+		defer mcpClient.Close()
 
 		// Create jsonStringArguments
 		configMap := map[string]interface{}{
-			"http_port":          httpPort,
 			"projects_directory": projectsDirectory,
 			"repository":         repository,
 			"workspace_name":     workspaceName,
 		}
+		// without http_port, the workspace keeps its port
+		if port, err := strconv.Atoi(httpPort); err == nil {
+			configMap["http_port"] = port
+		}
 
 		jsonStringArguments, err := json.Marshal(configMap)
 		if err != nil {
@@ -196,19 +204,24 @@ func startWorkspaceStreamHandler(ctx echo.Context) error {
 			return
 		}
 
-		progressChan <- "data: {\"progress\": 30, \"message\": \"Starting Docker build...\"}\n\n"
-
-		// Call MCP tool
-		toolResponse, err := mcpClient.CallTool(mcpCtx, "start_workspace", string(jsonStringArguments))
+		// Forward the progress and the build output sent by the MCP server while the tool runs
+		toolResponse, err := mcpClient.CallToolWithNotifications(mcpCtx, "start_workspace", string(jsonStringArguments), func(notification mcp.JSONRPCNotification) {
+			event := notificationEvent(notification)
+			if event == "" {
+				return
+			}
+			// the client may have closed the stream
+			select {
+			case progressChan <- event:
+			case <-ctx.Request().Context().Done():
+			}
+		})
 		if err != nil {
-			progressChan <- fmt.Sprintf("data: {\"error\": \"Failed to start workspace: %v\"}\n\n", err)
+			progressChan <- sseEvent(map[string]any{"error": fmt.Sprintf("Failed to start workspace: %v", err)})
 			return
 		}
-
-		progressChan <- "data: {\"progress\": 80, \"message\": \"Build completed, finalizing...\"}\n\n"
-
-		if toolResponse == nil || len(toolResponse.Content) == 0 {
-			progressChan <- "data: {\"error\": \"No content returned from MCP tool\"}\n\n"
+		if toolResponse.IsError {
+			progressChan <- sseEvent(map[string]any{"error": fmt.Sprintf("Failed to start workspace: %v", toolResponse.Content)})
 			return
 		}
 
@@ -237,6 +250,35 @@ func startWorkspaceStreamHandler(ctx echo.Context) error {
 	}
 }
 
+// notificationEvent converts a notification of the MCP server into an event of the stream:
+// {"progress": <percent>, "message": ...} for the progress of the build,
+// {"log": ..., "level": ...} for its output.
+func notificationEvent(notification mcp.JSONRPCNotification) string {
+	params := notification.Params.AdditionalFields
+	switch notification.Method {
+	case "notifications/progress":
+		progress, _ := params["progress"].(float64)
+		total, _ := params["total"].(float64)
+		message, _ := params["message"].(string)
+		if total <= 0 {
+			return ""
+		}
+		// 100 is sent with the access URL once the tool returns
+		return sseEvent(map[string]any{"progress": min(int(progress*100/total), 99), "message": message})
+	case "notifications/message":
+		return sseEvent(map[string]any{"log": params["data"], "level": params["level"]})
+	}
+	return ""
+}
+
+func sseEvent(data map[string]any) string {
+	event, err := json.Marshal(data)
+	if err != nil {
+		return ""
+	}
+	return "data: " + string(event) + "\n\n"
+}
+
 func startWorkspaceHandler(ctx echo.Context) error {
 	var config ConfigPayload
 	if err := ctx.Bind(&config); err != nil {
@@ -253,13 +295,15 @@ func startWorkspaceHandler(ctx echo.Context) error {
 		return ctx.JSON(http.StatusInternalServerError, HTTPMessageBody{Message: "Failed to create MCP client"})
 	}
 
-	// Create jsonStringArguments with the specific format required (http_port as string)
+	// Create jsonStringArguments (without http_port, the workspace keeps its port)
 	configMap := map[string]interface{}{
-		"http_port":          fmt.Sprintf("%d", config.HTTPPort), // Convert to string
 		"projects_directory": config.ProjectsDirectory,
 		"repository":         config.Repository,
 		"workspace_name":     config.WorkspaceName,
 	}
+	if config.HTTPPort != 0 {
+		configMap["http_port"] = config.HTTPPort
+	}
 
 	jsonStringArguments, err := json.Marshal(configMap)
 	if err != nil {
@@ -309,7 +353,7 @@ func stopWorkspaceHandler(ctx echo.Context) error {
 		return ctx.JSON(http.StatusInternalServerError, HTTPMessageBody{Message: "Failed to create MCP client"})
 	}
 
-	// Create jsonStringArguments with the specific format required (http_port as string)
+	// Create jsonStringArguments
 	configMap := map[string]interface{}{
 		"projects_directory": config.ProjectsDirectory,
 		"workspace_name":     config.WorkspaceName,
@@ -453,17 +497,18 @@ func dockerfilesListHandler(ctx echo.Context) error {
 		return ctx.JSON(http.StatusInternalServerError, HTTPMessageBody{Message: "No content returned from MCP tool"})
 	}
 
-	//logger.Infof("🟢 Dockerfiles list response: %+v", toolResponse)
-	/*
-		&{Result:{Meta:map[]} Content:[{Annotated:{Annotations:<nil>} Type:text Text:[\"golang.Dockerfile\",\"nodejs.Dockerfile\"]}] StructuredContent:<nil> IsError:false}"
-	*/
-	dockerFilesList := toolResponse.Content[0].(mcp.TextContent).Text
-	logger.Infof("🐳 Dockerfiles list: %v", dockerFilesList)
+	var dockerfilesList MCPDockerfilesList
+	if err := decodeStructuredContent(toolResponse, &dockerfilesList); err != nil {
+		logger.Errorf("Failed to parse Dockerfiles list: %v", err)
+		return ctx.JSON(http.StatusInternalServerError, HTTPMessageBody{Message: "Failed to parse Dockerfiles list"})
+	}
+	logger.Infof("🐳 Dockerfiles list: %v", dockerfilesList.Dockerfiles)
 
 	response := DockerfilesListResponse{
 		Status:      "success",
 		Message:     "Dockerfiles list retrieved successfully",
-		Dockerfiles: dockerFilesList,
+		Dockerfiles: dockerfilesList.Dockerfiles,
+		Templates:   dockerfilesList.Templates,
 	}
 
 	return ctx.JSON(http.StatusOK, response)
@@ -512,15 +557,19 @@ func workspacesListHandler(ctx echo.Context) error {
 	logger.Infof("🟢 Workspaces list response: %+v", toolResponse)
 
 	// Extract the workspaces list from the MCP tool response
-	workspacesList := toolResponse.Content[0].(mcp.TextContent).Text
-	logger.Infof("🗂️ Workspaces list: %v", workspacesList)
+	var workspacesList MCPWorkspacesList
+	if err := decodeStructuredContent(toolResponse, &workspacesList); err != nil {
+		logger.Errorf("Failed to parse workspaces list: %v", err)
+		return ctx.JSON(http.StatusInternalServerError, HTTPMessageBody{Message: "Failed to parse workspaces list"})
+	}
+	logger.Infof("🗂️ Workspaces list: %d workspace(s)", len(workspacesList.Workspaces))
 
 	// Return the response from MCP tool
 	response := WorkspacesListResponse{
 		Status:            "success",
 		Message:           "Workspaces list retrieved successfully",
 		ProjectsDirectory: request.ProjectsDirectory,
-		Workspaces:        workspacesList,
+		Workspaces:        workspacesList.Workspaces,
 	}
 
 	return ctx.JSON(http.StatusOK, response)
@@ -539,28 +588,37 @@ func workspaceStatusHandler(ctx echo.Context) error {
 
 	logger.Infof("Checking status for workspace: %s in directory: %s", request.WorkspaceName, request.ProjectsDirectory)
 
-	// Check Docker container status by running docker compose ps
-	cmd := exec.Command("docker", "compose", "ps", "--format", "json")
-	cmd.Dir = filepath.Join(request.ProjectsDirectory, request.WorkspaceName)
-	
-	output, err := cmd.Output()
+	if request.MCPServerURL == "" {
+		request.MCPServerURL = "http://host.docker.internal:9090/mcp"
+	}
+
+	// --- [MCP CLIENT] ---
+	mcpClient, err := tools.NewMCPClient(mcpCtx, request.MCPServerURL)
 	if err != nil {
-		logger.Errorf("Failed to check workspace status: %v", err)
-		// If command fails, workspace is likely not running
-		response := WorkspaceStatusResponse{
-			Status:        "success",
-			Message:       "Workspace status checked",
-			WorkspaceName: request.WorkspaceName,
-			IsRunning:     false,
-			ContainerInfo: "Not running or not found",
-		}
-		return ctx.JSON(http.StatusOK, response)
+		logger.Errorf("Failed to create MCP client: %v", err)
+		return ctx.JSON(http.StatusInternalServerError, HTTPMessageBody{Message: "Failed to create MCP client"})
 	}
 
-	// Parse the JSON output to check container status
-	var containers []map[string]interface{}
-	if err := json.Unmarshal(output, &containers); err != nil {
-		logger.Errorf("Failed to parse docker compose output: %v", err)
+	argsMap := map[string]interface{}{
+		"projects_directory": request.ProjectsDirectory,
+		"workspace_name":     request.WorkspaceName,
+	}
+	jsonStringArguments, err := json.Marshal(argsMap)
+	if err != nil {
+		logger.Errorf("Failed to marshal workspace status args to JSON: %v", err)
+		return ctx.JSON(http.StatusInternalServerError, HTTPMessageBody{Message: "Failed to marshal arguments"})
+	}
+
+	// Call the get_workspace_status MCP tool
+	toolResponse, err := mcpClient.CallTool(mcpCtx, "get_workspace_status", string(jsonStringArguments))
+	if err != nil {
+		logger.Errorf("Failed to call get_workspace_status MCP tool: %v", err)
+		return ctx.JSON(http.StatusInternalServerError, HTTPMessageBody{Message: "Failed to get workspace status"})
+	}
+
+	var workspaceStatus MCPWorkspaceStatus
+	if err := decodeStructuredContent(toolResponse, &workspaceStatus); err != nil {
+		logger.Errorf("No workspace status returned: %v", err)
 		response := WorkspaceStatusResponse{
 			Status:        "success",
 			Message:       "Workspace status checked",
@@ -571,34 +629,29 @@ func workspaceStatusHandler(ctx echo.Context) error {
 		return ctx.JSON(http.StatusOK, response)
 	}
 
-	// Check if any containers are running
-	isRunning := false
 	containerInfo := "No containers found"
-	
-	if len(containers) > 0 {
+	if len(workspaceStatus.Services) > 0 {
 		runningContainers := 0
-		totalContainers := len(containers)
-		
-		for _, container := range containers {
-			if state, ok := container["State"].(string); ok && (state == "running" || state == "Up") {
+		for _, service := range workspaceStatus.Services {
+			if service.State == "running" {
 				runningContainers++
-				isRunning = true
 			}
 		}
-		
-		if isRunning {
-			containerInfo = fmt.Sprintf("%d/%d containers running", runningContainers, totalContainers)
+		if workspaceStatus.Running {
+			containerInfo = fmt.Sprintf("%d/%d containers running", runningContainers, len(workspaceStatus.Services))
 		} else {
-			containerInfo = fmt.Sprintf("%d containers stopped", totalContainers)
+			containerInfo = fmt.Sprintf("%d containers stopped", len(workspaceStatus.Services))
 		}
 	}
 
 	response := WorkspaceStatusResponse{
-		Status:        "success",
-		Message:       "Workspace status checked",
-		WorkspaceName: request.WorkspaceName,
-		IsRunning:     isRunning,
-		ContainerInfo: containerInfo,
+		Status:         "success",
+		Message:        "Workspace status checked",
+		WorkspaceName:  request.WorkspaceName,
+		IsRunning:      workspaceStatus.Running,
+		ContainerInfo:  containerInfo,
+		WorkspaceState: workspaceStatus.State,
+		AccessURL:      workspaceStatus.AccessURL,
 	}
 
 	return ctx.JSON(http.StatusOK, response)
@@ -613,6 +666,8 @@ type ConfigPayload struct {
 	GitUserEmail      string `json:"git_user_email"`
 	GitUserName       string `json:"git_user_name"`
 	GitHost           string `json:"git_host"`
+	GitToken          string `json:"git_token,omitempty"`
+	SSHAuth           string `json:"ssh_auth,omitempty"`
 	Repository        string `json:"repository"`
 	WorkspaceName     string `json:"workspace_name"`
 	ProjectsDirectory string `json:"projects_directory"`
@@ -652,29 +707,92 @@ type WorkspaceListRequest struct {
 }
 
 type DockerfilesListResponse struct {
-	Status      string `json:"status"`
-	Message     string `json:"message"`
-	Dockerfiles string `json:"dockerfiles"`
+	Status      string         `json:"status"`
+	Message     string         `json:"message"`
+	Dockerfiles []string       `json:"dockerfiles"`
+	Templates   []TemplateInfo `json:"templates"`
 }
 
 type WorkspacesListResponse struct {
-	Status            string `json:"status"`
-	Message           string `json:"message"`
-	ProjectsDirectory string `json:"projects_directory"`
-	Workspaces        string `json:"workspaces"`
+	Status            string                 `json:"status"`
+	Message           string                 `json:"message"`
+	ProjectsDirectory string                 `json:"projects_directory"`
+	Workspaces        []MCPWorkspaceManifest `json:"workspaces"`
 }
 
 type WorkspaceStatusRequest struct {
 	ProjectsDirectory string `json:"projects_directory"`
 	WorkspaceName     string `json:"workspace_name"`
+	MCPServerURL      string `json:"mcp_server_url"`
 }
 
 type WorkspaceStatusResponse struct {
-	Status        string `json:"status"`
-	Message       string `json:"message"`
+	Status         string `json:"status"`
+	Message        string `json:"message"`
+	WorkspaceName  string `json:"workspace_name"`
+	IsRunning      bool   `json:"is_running"`
+	ContainerInfo  string `json:"container_info"`
+	WorkspaceState string `json:"workspace_state,omitempty"`
+	AccessURL      string `json:"access_url,omitempty"`
+}
+
+// MCPDockerfilesList is the structured content of the get_dockerfiles_list MCP tool.
+type MCPDockerfilesList struct {
+	Dockerfiles []string       `json:"dockerfiles"`
+	Templates   []TemplateInfo `json:"templates"`
+}
+
+// TemplateInfo describes a Dockerfile template of the get_dockerfiles_list MCP tool.
+type TemplateInfo struct {
+	Name           string            `json:"name"`
+	DisplayName    string            `json:"display_name"`
+	Language       string            `json:"language,omitempty"`
+	Description    string            `json:"description,omitempty"`
+	ToolVersions   map[string]string `json:"tool_versions,omitempty"`
+	BuildArgs      map[string]string `json:"build_args,omitempty"`
+	Tags           []string          `json:"tags,omitempty"`
+	DockerInDocker bool              `json:"docker_in_docker"`
+}
+
+// MCPWorkspacesList is the structured content of the get_workspaces_list MCP tool.
+type MCPWorkspacesList struct {
+	Workspaces []MCPWorkspaceManifest `json:"workspaces"`
+}
+
+// MCPWorkspaceManifest is the manifest of a workspace, as returned by the get_workspaces_list MCP tool.
+type MCPWorkspaceManifest struct {
+	WorkspaceName       string `json:"workspace_name"`
+	ProjectsDirectory   string `json:"projects_directory"`
+	Repository          string `json:"repository,omitempty"`
+	GitHost             string `json:"git_host,omitempty"`
+	GitUserName         string `json:"git_user_name,omitempty"`
+	GitUserEmail        string `json:"git_user_email,omitempty"`
+	KeyName             string `json:"key_name,omitempty"`
+	SSHAuth             string `json:"ssh_auth,omitempty"`
+	DockerfileName      string `json:"dockerfile_name,omitempty"`
+	ComposeFileName     string `json:"compose_file_name,omitempty"`
+	OffloadOverrideName string `json:"offload_override_name,omitempty"`
+	HTTPPort            string `json:"http_port,omitempty"`
+	ProjectName         string `json:"project_name,omitempty"`
+	State               string `json:"state"`
+	LastError           string `json:"last_error,omitempty"`
+	CreatedAt           string `json:"created_at,omitempty"`
+	StartedAt           string `json:"started_at,omitempty"`
+	StoppedAt           string `json:"stopped_at,omitempty"`
+}
+
+// MCPWorkspaceStatus is the structured content of the get_workspace_status MCP tool.
+type MCPWorkspaceStatus struct {
 	WorkspaceName string `json:"workspace_name"`
-	IsRunning     bool   `json:"is_running"`
-	ContainerInfo string `json:"container_info"`
+	State         string `json:"state"`
+	Running       bool   `json:"running"`
+	Services      []struct {
+		Service string `json:"service"`
+		State   string `json:"state"`
+		Health  string `json:"health"`
+		Image   string `json:"image"`
+	} `json:"services"`
+	AccessURL string `json:"access_url"`
 }
 
 func GetChatAgent(ctx context.Context, name string, appConfig config.Config, contentData data.PromptData, clientEngine openai.Client) (*agents.Agent, error) {
@@ -711,3 +829,16 @@ func GetToolsAgent(ctx context.Context, name string, appConfig config.Config, cl
 	}
 	return toolsAgent, nil
 }
+
+// decodeStructuredContent decodes the structured content of an MCP tool result into value.
+// The MCP client decodes it as a map, it is converted with a JSON round trip.
+func decodeStructuredContent(toolResponse *mcp.CallToolResult, value any) error {
+	if toolResponse.IsError || toolResponse.StructuredContent == nil {
+		return fmt.Errorf("no structured content in the tool result: %+v", toolResponse.Content)
+	}
+	structuredContent, err := json.Marshal(toolResponse.StructuredContent)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(structuredContent, value)
+}
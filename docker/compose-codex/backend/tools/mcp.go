@@ -88,6 +88,35 @@ func (c *MCPClient) CallTool(ctx context.Context, functionName string, arguments
 	return toolResponse, nil
 }
 
+// CallToolWithNotifications calls a tool and passes the progress and logging
+// notifications the server sends while the tool runs to onNotification.
+func (c *MCPClient) CallToolWithNotifications(ctx context.Context, functionName string, arguments string, onNotification func(notification mcp.JSONRPCNotification)) (*mcp.CallToolResult, error) {
+	c.mcpclient.OnNotification(onNotification)
+
+	// NOTE: the server sends the log messages only once the level is set
+	levelRequest := mcp.SetLevelRequest{}
+	levelRequest.Params.Level = mcp.LoggingLevelInfo
+	if err := c.mcpclient.SetLevel(ctx, levelRequest); err != nil {
+		return nil, fmt.Errorf("error setting the log level: %w", err)
+	}
+
+	args, _ := JsonStringToMap(arguments)
+	request := mcp.CallToolRequest{}
+	request.Params.Name = functionName
+	request.Params.Arguments = args
+	// NOTE: the progress token asks the server for progress notifications
+	request.Params.Meta = &mcp.Meta{ProgressToken: functionName}
+
+	toolResponse, err := c.mcpclient.CallTool(ctx, request)
+	if err != nil {
+		return nil, fmt.Errorf("error calling tool %s: %w", functionName, err)
+	}
+	if toolResponse == nil || len(toolResponse.Content) == 0 {
+		return nil, fmt.Errorf("no content returned from tool %s", functionName)
+	}
+	return toolResponse, nil
+}
+
 func convertMCPToolsToOpenAITools(tools *mcp.ListToolsResult) []openai.ChatCompletionToolParam {
 	openAITools := make([]openai.ChatCompletionToolParam, len(tools.Tools))
 	for i, tool := range tools.Tools {
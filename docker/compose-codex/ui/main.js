@@ -179,19 +179,29 @@ loadDockerfilesButton.addEventListener('click', async () => {
         });
         
         // Display the response
-        if (result && result.dockerfiles) {
-            // Parse the dockerfiles JSON string and format it nicely
-            try {
-                const dockerfilesList = JSON.parse(result.dockerfiles);
-                if (Array.isArray(dockerfilesList) && dockerfilesList.length > 0) {
-                    dockerfilesResponseTextarea.value = `Found ${dockerfilesList.length} Dockerfile(s):\n\n` + 
-                        dockerfilesList.map((file, index) => `${index + 1}. ${file}`).join('\n');
-                } else {
-                    dockerfilesResponseTextarea.value = 'No Dockerfile files found in the current directory.';
-                }
-            } catch (parseError) {
-                // If parsing fails, show the raw response
-                dockerfilesResponseTextarea.value = `Response: ${result.message || 'Unknown response'}\nDockerfiles: ${result.dockerfiles}`;
+        if (result && Array.isArray(result.templates)) {
+            // Format the templates catalog nicely
+            const templates = result.templates;
+            if (templates.length > 0) {
+                dockerfilesResponseTextarea.value = `Found ${templates.length} Dockerfile(s):\n\n` +
+                    templates.map((template, index) => {
+                        const language = template.language ? ` (${template.language})` : '';
+                        const tools = Object.entries(template.tool_versions || {}).map(([tool, version]) => `${tool} ${version}`).join(', ');
+                        return `${index + 1}. ${template.display_name}${language}: ${template.name}\n` +
+                            (template.description ? `   ${template.description}\n` : '') +
+                            (tools ? `   Tools: ${tools}\n` : '');
+                    }).join('\n');
+            } else {
+                dockerfilesResponseTextarea.value = 'No Dockerfile files found in the current directory.';
+            }
+        } else if (result && Array.isArray(result.dockerfiles)) {
+            // Format the dockerfiles list nicely
+            const dockerfilesList = result.dockerfiles;
+            if (dockerfilesList.length > 0) {
+                dockerfilesResponseTextarea.value = `Found ${dockerfilesList.length} Dockerfile(s):\n\n` + 
+                    dockerfilesList.map((file, index) => `${index + 1}. ${file}`).join('\n');
+            } else {
+                dockerfilesResponseTextarea.value = 'No Dockerfile files found in the current directory.';
             }
         } else {
             dockerfilesResponseTextarea.value = JSON.stringify(result, null, 2);
@@ -228,9 +238,8 @@ async function populateDockerfilesDropdown() {
             mcp_server_url: mcpServerUrl
         });
         
-        if (result && result.dockerfiles) {
-            // Parse the dockerfiles JSON string
-            const dockerfilesList = JSON.parse(result.dockerfiles);
+        if (result && Array.isArray(result.dockerfiles)) {
+            const dockerfilesList = result.dockerfiles;
             
             // Clear existing options
             dockerfileNameSelect.innerHTML = '';
@@ -341,12 +350,13 @@ function saveWorkspaceToList(workspaceData) {
         // Get existing workspaces from localStorage
         const existingWorkspaces = JSON.parse(localStorage.getItem('composeCodexWorkspaces') || '[]');
         
-        // Create workspace entry
+        // Create workspace entry (the git token is never stored in localStorage)
+        const { git_token, ...fullConfig } = workspaceData;
         const workspaceEntry = {
             workspace_name: workspaceData.workspace_name,
             repository: workspaceData.repository,
             created_at: new Date().toISOString(),
-            full_config: workspaceData
+            full_config: fullConfig
         };
         
         // Check if workspace already exists (by name)
@@ -450,7 +460,8 @@ async function checkAllWorkspaceStatuses(workspaces) {
         try {
             const result = await ddClient.extension.vm.service.post('/workspace/status', {
                 projects_directory: workspace.full_config.projects_directory,
-                workspace_name: workspace.workspace_name
+                workspace_name: workspace.workspace_name,
+                mcp_server_url: workspace.full_config.mcp_server_url
             });
             
             return {
@@ -740,9 +751,8 @@ async function regenerateWorkspacesList() {
         
         console.log('Workspace list response:', result);
         
-        if (result && result.status === 'success' && result.workspaces) {
-            // Parse the workspaces JSON string
-            const workspacesList = JSON.parse(result.workspaces);
+        if (result && result.status === 'success' && Array.isArray(result.workspaces)) {
+            const workspacesList = result.workspaces;
             
             if (Array.isArray(workspacesList) && workspacesList.length > 0) {
                 // Get existing workspaces to preserve any existing configuration
@@ -752,38 +762,34 @@ async function regenerateWorkspacesList() {
                     existingWorkspaceMap.set(ws.workspace_name, ws);
                 });
                 
-                // Create workspace entries for localStorage
-                const regeneratedWorkspaces = workspacesList.map(workspaceName => {
+                // Create workspace entries for localStorage from the manifests stored by the MCP server
+                const regeneratedWorkspaces = workspacesList.map(manifest => {
+                    const workspaceName = manifest.workspace_name;
                     const existingWorkspace = existingWorkspaceMap.get(workspaceName);
+                    const mcpServerUrl = existingWorkspace?.full_config?.mcp_server_url || 'http://host.docker.internal:9090/mcp';
                     
-                    // If workspace exists, preserve its configuration AND status
-                    if (existingWorkspace) {
-                        return {
-                            ...existingWorkspace,
-                            created_at: existingWorkspace.created_at || new Date().toISOString(), // Preserve original creation date
-                            status: existingWorkspace.status, // Preserve status
-                            last_status_check: existingWorkspace.last_status_check // Preserve last check time
-                        };
-                    }
-                    
-                    // Create new workspace entry with default values
+                    // The manifest is the source of truth, keep only the status from the local entry
                     return {
                         workspace_name: workspaceName,
-                        repository: 'unknown', // We don't have this info from the list endpoint
-                        created_at: new Date().toISOString(),
+                        repository: manifest.repository || 'unknown',
+                        created_at: manifest.created_at || existingWorkspace?.created_at || new Date().toISOString(),
+                        state: manifest.state,
+                        status: existingWorkspace?.status, // Preserve status
+                        last_status_check: existingWorkspace?.last_status_check, // Preserve last check time
                         full_config: {
                             workspace_name: workspaceName,
-                            projects_directory: projectsDirectory,
-                            repository: 'unknown',
-                            http_port: 8080 + Math.floor(Math.random() * 1000), // Random port between 8080-9080
-                            dockerfile_name: '_.Dockerfile',
-                            compose_file_name: 'compose.yml',
-                            offload_override_name: 'compose.offload.yml',
-                            key_name: '',
-                            git_user_email: '',
-                            git_user_name: '',
-                            git_host: 'github.com',
-                            mcp_server_url: 'http://host.docker.internal:9090/mcp'
+                            projects_directory: manifest.projects_directory || projectsDirectory,
+                            repository: manifest.repository || 'unknown',
+                            http_port: manifest.http_port ? parseInt(manifest.http_port, 10) : existingWorkspace?.full_config?.http_port,
+                            dockerfile_name: manifest.dockerfile_name || '_.Dockerfile',
+                            compose_file_name: manifest.compose_file_name || 'compose.yml',
+                            offload_override_name: manifest.offload_override_name || 'compose.offload.yml',
+                            key_name: manifest.key_name || '',
+                            ssh_auth: manifest.ssh_auth || 'key',
+                            git_user_email: manifest.git_user_email || '',
+                            git_user_name: manifest.git_user_name || '',
+                            git_host: manifest.git_host || 'github.com',
+                            mcp_server_url: mcpServerUrl
                         }
                     };
                 });
@@ -1134,8 +1140,10 @@ function clearFormFields() {
     // Clear workspace name
     document.getElementById('workspaceName').value = '';
     
-    // Clear repository
+    // Clear repository and git token
     document.getElementById('repository').value = '';
+    document.getElementById('gitToken').value = '';
+    document.getElementById('sshAuth').value = 'key';
     
     // Clear HTTP port (set to 0)
     document.getElementById('httpPort').value = '0';
@@ -1198,7 +1206,6 @@ function setupAutoSave() {
 // Form validation functionality
 function validateWorkspaceForm() {
     const requiredFields = [
-        { id: 'keyName', name: 'SSH Key Name' },
         { id: 'workspaceName', name: 'Workspace Name' },
         { id: 'gitUserEmail', name: 'Git User Email' },
         { id: 'gitUserName', name: 'Git Username' },
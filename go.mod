@@ -1,4 +1,4 @@
-module mcp-compose-codex
+module github.com/k33g/compose-codex
 
 go 1.24.0
 
@@ -11,7 +11,11 @@ require (
 	github.com/spf13/cast v1.9.2 // indirect
 	github.com/wk8/go-ordered-map/v2 v2.1.8 // indirect
 	github.com/yosida95/uritemplate/v3 v3.0.2 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
+	golang.org/x/sys v0.33.0 // indirect
 )
 
-require github.com/mark3labs/mcp-go v0.36.0
+require (
+	github.com/mark3labs/mcp-go v0.38.0
+	golang.org/x/crypto v0.38.0
+	gopkg.in/yaml.v3 v3.0.1
+)
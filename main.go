@@ -2,24 +2,144 @@ package main
 
 import (
 	"context"
+	"embed"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
+	"log/slog"
+	"maps"
+	"net/http"
 	"os"
-	"os/exec"
-	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/mark3labs/mcp-go/mcp"
 	"github.com/mark3labs/mcp-go/server"
+
+	"github.com/k33g/compose-codex/workspace"
 )
 
+// embeddedTemplates are the default templates: the server runs without the repository.
+// The templates of the templates directory override them.
+//
+//go:embed *.Dockerfile compose.yml compose.offload.yml
+var embeddedTemplates embed.FS
+
 func main() {
 
+	// The configuration file, the environment and the flags
+	config, err := loadConfig(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	config.setupLogging()
+
+	// Former versions wrote the base64 encoded SSH key of the last workspace in project.env
+	if err := os.Remove("project.env"); err == nil {
+		log.Println("🧹 Removed the project.env file left by a previous version (it contained an SSH private key)")
+	}
+	// The relative projects directories are resolved against the projects root
+	if config.ProjectsRoot != "" {
+		if err := os.MkdirAll(config.ProjectsRoot, 0755); err != nil {
+			fatalf("Failed to create the projects root %s: %v", config.ProjectsRoot, err)
+		}
+		if err := os.Chdir(config.ProjectsRoot); err != nil {
+			fatalf("Failed to enter the projects root %s: %v", config.ProjectsRoot, err)
+		}
+	}
+
+	// The tool calls can be cancelled by the client and time out
+	calls := newToolCalls(config.toolTimeouts)
+	hooks := &server.Hooks{}
+	hooks.AddBeforeCallTool(calls.identify)
+
+	// The arguments repeated by the tools (projects directory, git user) take the defaults
+	// of the session, set with set_defaults, or else the ones of the server
+	serverDefaults, err := loadServerDefaults(config.ProjectsDirectory)
+	if err != nil {
+		fatalf("Invalid default arguments: %v", err)
+	}
+	defaults := newToolDefaults(serverDefaults)
+
 	// Create MCP server
 	s := server.NewMCPServer(
 		"mcp-compose-codex",
 		"0.0.0",
+		// the output of the builds is sent as logging notifications
+		server.WithLogging(),
+		server.WithHooks(hooks),
+		server.WithToolHandlerMiddleware(calls.middleware),
+		server.WithToolHandlerMiddleware(defaults.middleware),
 	)
+	s.AddNotificationHandler("notifications/cancelled", calls.cancel)
+
+	// The workspace engine reads the templates and the SSH keys
+	engineOptions := []workspace.EngineOption{
+		workspace.WithTemplatesFS(embeddedTemplates),
+		workspace.WithTemplatesDirectory(config.TemplatesDirectory),
+	}
+	if config.SSHDirectory != "" {
+		engineOptions = append(engineOptions, workspace.WithSSHDirectory(config.SSHDirectory))
+	}
+	// The HTTP ports of the workspaces are allocated from the port range (e.g. 8100-8199)
+	if config.PortRange != "" {
+		engineOptions = append(engineOptions, workspace.WithPortRange(config.portRangeStart, config.portRangeEnd))
+	}
+	// The removed workspaces stay the trash retention in the trash (e.g. 72h, 0 to delete them at once)
+	if config.TrashRetention != "" {
+		engineOptions = append(engineOptions, workspace.WithTrashRetention(config.trashRetention))
+	}
+	engine := workspace.NewEngine(engineOptions...)
+
+	// The operations run with async are jobs, their history survives the restarts
+	jobs, err := workspace.NewJobs(engine.JobsDirectory)
+	if err != nil {
+		fatalf("Failed to load the jobs of %s: %v", engine.JobsDirectory, err)
+	}
+
+	// runOperation runs a workspace operation for a tool: in a background job when the async
+	// argument is set, returning the job at once, otherwise in the tool call, reporting its progress.
+	runOperation := func(ctx context.Context, request mcp.CallToolRequest, action, projectsDirectory, workspaceName string, operation func(ctx context.Context) (*workspace.Result, error)) *mcp.CallToolResult {
+		tool := request.Params.Name
+		if async, _ := request.GetArguments()["async"].(bool); async {
+			job, err := jobs.Submit(action, workspaceName, projectsDirectory, calls.timeouts[tool], operation)
+			if err != nil {
+				slog.Error(fmt.Sprintf("Failed to submit the %s job of workspace %s: %v", action, workspaceName, err))
+				return mcp.NewToolResultError(fmt.Sprintf("Failed to submit the %s job of workspace %s: %v", action, workspaceName, err))
+			}
+			log.Printf("Job %s submitted: %s workspace %s", job.ID, action, workspaceName)
+			return mcp.NewToolResultStructured(job, fmt.Sprintf("Job %s submitted: %s workspace %s.\nFollow it with get_job_status and get_job_log, cancel it with cancel_job.", job.ID, action, workspaceName))
+		}
+		ctx = workspace.WithReporter(ctx, newToolReporter(ctx, s, request, tool))
+		result, err := operation(ctx)
+		if action == "purge" {
+			return purgeToolResult(result, err)
+		}
+		return workspaceToolResult(action, result, err)
+	}
+
+	// The template arguments are enums of the templates available at start
+	dockerfiles, err := engine.Dockerfiles()
+	if err != nil {
+		fatalf("Failed to read the templates of %s: %v", engine.TemplatesDirectory, err)
+	}
+	// compose_file_name is a base compose file, offload_override_name an override (see BaseComposeFiles)
+	baseComposeFiles, err := engine.BaseComposeFiles()
+	if err != nil {
+		fatalf("Failed to read the templates of %s: %v", engine.TemplatesDirectory, err)
+	}
+	overrideComposeFiles, err := engine.OverrideComposeFiles()
+	if err != nil {
+		fatalf("Failed to read the templates of %s: %v", engine.TemplatesDirectory, err)
+	}
 
 	// =================================================
 	// TOOLS:
@@ -27,55 +147,70 @@ func main() {
 	initializeWokspace := mcp.NewTool("initializer_workspace",
 		mcp.WithDescription("Create a workspace for the user with the provided informations."),
 		mcp.WithString("key_name",
-			mcp.Required(),
-			mcp.Description("The name of the SSH key to use for the workspace. The key must be available in the keys directory."),
+			mcp.Description("The name of the SSH key to use for the workspace. The key must be available in the keys directory. Required to clone with SSH and the key mode, optional with HTTPS. Defaults to the key of the session (see set_defaults)."),
+		),
+		mcp.WithString("ssh_auth",
+			mcp.Description("How the workspace authenticates to the git host with SSH: key (copy the SSH key key_name into the workspace, default), agent (forward the SSH agent of the host to the web IDE, no key is copied) or deploy_key (generate a key for the workspace only, its public key is returned to be added as a deploy key of the repository, which is cloned at the first start)."),
+			mcp.Enum("key", "agent", "deploy_key"),
+			mcp.DefaultString(serverDefaults["ssh_auth"]),
 		),
 		mcp.WithString("git_user_email",
-			mcp.Required(),
-			mcp.Description("The email of the git user to use for the workspace. The email will be used to clone the repository and to commit changes. It can be your GitHub or GitLab email."),
+			mcp.Description("The email of the git user to use for the workspace. The email will be used to clone the repository and to commit changes. It can be your GitHub or GitLab email. Required, unless a default is set (see set_defaults)."),
 		),
 		mcp.WithString("git_user_name",
-			mcp.Required(),
-			mcp.Description("The name of the git user to use for the workspace. The user name will be used to clone the repository and to commit changes."),
+			mcp.Description("The name of the git user to use for the workspace. The user name will be used to clone the repository and to commit changes. Required, unless a default is set (see set_defaults)."),
 		),
 		mcp.WithString("git_host",
-			mcp.Required(),
-			mcp.Description("The git host to use for the workspace. The host will be used to clone the repository and to commit changes. It can be github.com, gitlab.com, etc."),
+			mcp.Description("The git host to use for the workspace. The host will be used to clone the repository and to commit changes. It can be github.com, gitlab.com, bitbucket.org, a self-hosted server with a port (gitlab.example.com:2222) or a URL to clone with HTTPS (https://gitlab.example.com). Not needed when repository is a full clone URL."),
+			mcp.DefaultString(serverDefaults["git_host"]),
 		),
 		mcp.WithString("repository",
 			mcp.Required(),
-			mcp.Description("The repository to clone for the workspace. The repository must be available on the git host. It can be a public or private repository."),
+			mcp.Description("The repository to clone for the workspace: a path on the git host (owner/project.git), or a full clone URL (git@host:owner/project.git, ssh://git@host:2222/owner/project.git, https://host/owner/project.git). It can be a public or private repository."),
+		),
+		mcp.WithString("git_token",
+			mcp.Description("An access token to clone a private repository with HTTPS (GitHub, GitLab or Bitbucket token). Optional."),
 		),
 		mcp.WithString("workspace_name",
 			mcp.Required(),
 			mcp.Description("The name of the workspace to create. The workspace will be created in the projects directory. It can be any name you want."),
 		),
 		mcp.WithString("projects_directory",
-			mcp.Required(),
-			mcp.Description("The directory where the workspace will be created. The directory must be available in the current directory. It can be any name you want."),
+			mcp.Description("The directory where the workspace will be created. Defaults to the projects directory of the session (see set_defaults)."),
 		),
 		mcp.WithString("dockerfile_name",
 			mcp.Required(),
-			mcp.Description("The name of the Dockerfile to use for the workspace. The Dockerfile must be available in the current directory. It can be any name you want."),
+			mcp.Description("The Dockerfile template of the workspace, for the language of the repository (see get_dockerfiles_list)."),
+			templateEnum(dockerfiles),
 		),
 		mcp.WithString("compose_file_name",
-			mcp.Required(),
-			mcp.Description("The name of the compose file to use for the workspace. The compose file must be available in the current directory. It can be any name you want."),
+			mcp.Description("The compose file template of the workspace. Keep the default unless asked otherwise."),
+			templateEnum(baseComposeFiles),
+			mcp.DefaultString(workspace.DefaultComposeFileName),
 		),
 		mcp.WithString("offload_override_name",
-			mcp.Required(),
-			mcp.Description("The name of the offload override file to use for the workspace. The offload override file must be available in the current directory. It can be any name you want."),
+			mcp.Description("The compose file template overriding the compose file to run the workspace with Docker Offload. Keep the default unless asked otherwise."),
+			templateEnum(overrideComposeFiles),
+			mcp.DefaultString(workspace.DefaultOffloadOverrideName),
 		),
-		mcp.WithString("http_port",
-			mcp.Required(),
-			mcp.Description("The port to use for the web IDE. The port must be available in the current directory. It can be any port you want."),
+		mcp.WithNumber("http_port",
+			mcp.Description("The port of the web IDE on the host. When omitted, a free port of the range of the server is allocated. A port reserved by another workspace or used by another process of the host is rejected."),
+			mcp.Min(1),
+			mcp.Max(65535),
+		),
+		mcp.WithObject("build_args",
+			mcp.Description("Overrides of the build args of the Dockerfile template, by name, e.g. {\"GO_VERSION\": \"1.25.0\"}. Only the build args the template declares are accepted (see the build_args of get_dockerfiles_list). Optional: the defaults of the template are used."),
+			mcp.AdditionalProperties(map[string]any{"type": "string"}),
 		),
+		onBusyOption(),
+		asyncOption(),
 	)
+	defaults.declare(initializeWokspace)
 	s.AddTool(initializeWokspace, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 		args := request.GetArguments()
 		// Check if the required arguments are provided
 		if len(args) == 0 {
-			return mcp.NewToolResultText("Please provide the required arguments: key_name, git_user_email, git_user_name, git_host, repository, workspace_name, projects_directory, dockerfile_name, compose_file_name, offload_override_name, http_port"), nil
+			return mcp.NewToolResultError("Please provide the required arguments: git_user_email, git_user_name, repository, workspace_name, projects_directory, dockerfile_name"), nil
 		}
 		// Extract the arguments
 		keyName, _ := args["key_name"].(string)
@@ -83,113 +218,181 @@ func main() {
 		gitUserName, _ := args["git_user_name"].(string)
 		gitHost, _ := args["git_host"].(string)
 		repository, _ := args["repository"].(string)
+		gitToken, _ := args["git_token"].(string)
+		sshAuthName, _ := args["ssh_auth"].(string)
 		workspaceName, _ := args["workspace_name"].(string)
 		projectsDirectory, _ := args["projects_directory"].(string)
 		dockerfileName, _ := args["dockerfile_name"].(string)
 		composeFileName, _ := args["compose_file_name"].(string)
 		offloadOverrideName, _ := args["offload_override_name"].(string)
-		httpPort, _ := args["http_port"].(string)
+		httpPort := numberArgument(args, "http_port")
+		buildArgs := stringMapArgument(args, "build_args")
 		// Check if the required arguments are provided
-		if keyName == "" || gitUserEmail == "" || gitUserName == "" || gitHost == "" ||
-			repository == "" || workspaceName == "" || projectsDirectory == "" ||
-			dockerfileName == "" || composeFileName == "" || offloadOverrideName == "" || httpPort == "" {
-			return mcp.NewToolResultText("Please provide all the required arguments: key_name, git_user_email, git_user_name, git_host, repository, workspace_name, projects_directory, dockerfile_name, compose_file_name, offload_override_name, http_port"), nil
+		if gitUserEmail == "" || gitUserName == "" ||
+			repository == "" || workspaceName == "" || projectsDirectory == "" || dockerfileName == "" {
+			return mcp.NewToolResultError("Please provide all the required arguments: git_user_email, git_user_name, repository, workspace_name, projects_directory, dockerfile_name (the git user can be set once for the session with set_defaults)"), nil
+		}
+		sshAuth, err := workspace.ParseSSHAuth(sshAuthName)
+		if err != nil {
+			return mcp.NewToolResultError("Please provide a valid ssh_auth: key, agent or deploy_key"), nil
 		}
 		// Create the workspace
 		log.Println("Creating workspace", workspaceName, "in directory", projectsDirectory)
 		log.Println("Using Dockerfile", dockerfileName, "and compose file", composeFileName)
 		log.Println("Using offload override file", offloadOverrideName)
-		log.Println("Using HTTP port", httpPort)
-		log.Println("Using SSH key", keyName)
+		if httpPort != "" {
+			log.Println("Using HTTP port", httpPort)
+		}
+		if len(buildArgs) > 0 {
+			log.Println("Using build args", buildArgs)
+		}
+		log.Println("Using SSH authentication", sshAuth, "with SSH key", keyName)
 		log.Println("Using Git user email", gitUserEmail, "and user name", gitUserName)
 		log.Println("Using Git host", gitHost)
 		log.Println("Using repository", repository)
 
-		// Set environment variables for the script
-		env := os.Environ()
-		env = append(env, "KEY_NAME="+keyName)
-		env = append(env, "GIT_USER_EMAIL="+gitUserEmail)
-		env = append(env, "GIT_USER_NAME="+gitUserName)
-		env = append(env, "GIT_HOST="+gitHost)
-		env = append(env, "REPOSITORY="+repository)
-		env = append(env, "WORKSPACE_NAME="+workspaceName)
-		env = append(env, "PROJECTS_DIRECTORY="+projectsDirectory)
-		env = append(env, "DOCKERFILE_NAME="+dockerfileName)
-		env = append(env, "COMPOSE_FILE_NAME="+composeFileName)
-		env = append(env, "OFFLOAD_OVERRIDE_NAME="+offloadOverrideName)
-		env = append(env, "HTTP_PORT="+httpPort)
-
-		// Execute the initialize-workspace.sh script
-		cmd := exec.Command("./initialize-workspace.sh")
-		cmd.Env = env
-
-		output, err := cmd.CombinedOutput()
-		if err != nil {
-			log.Printf("Error executing initialize-workspace.sh: %v", err)
-			log.Printf("Script output: %s", string(output))
-			return mcp.NewToolResultText(fmt.Sprintf("Failed to create workspace: %v\nOutput: %s", err, string(output))), nil
+		options := workspace.CreateOptions{
+			KeyName:             keyName,
+			SSHAuth:             sshAuth,
+			GitUserEmail:        gitUserEmail,
+			GitUserName:         gitUserName,
+			GitHost:             gitHost,
+			Repository:          repository,
+			GitToken:            gitToken,
+			WorkspaceName:       workspaceName,
+			ProjectsDirectory:   projectsDirectory,
+			DockerfileName:      dockerfileName,
+			ComposeFileName:     composeFileName,
+			OffloadOverrideName: offloadOverrideName,
+			HTTPPort:            httpPort,
+			BuildArgs:           buildArgs,
+			OnBusy:              onBusy(request),
 		}
-
-		log.Printf("Workspace creation successful. Script output: %s", string(output))
-		return mcp.NewToolResultText(fmt.Sprintf("Workspace %s created successfully!\n\nScript output:\n%s", workspaceName, string(output))), nil
+		if err := engine.ValidateCreate(options); err != nil {
+			return validationToolResult("create", workspaceName, err), nil
+		}
+		return runOperation(ctx, request, "create", projectsDirectory, workspaceName, func(ctx context.Context) (*workspace.Result, error) {
+			return engine.Create(ctx, options)
+		}), nil
 	})
 
 	// =================================================
 	// START WORKSPACE TOOL:
 	// =================================================
 	startWorkspace := mcp.NewTool("start_workspace",
-		mcp.WithDescription("Start a local workspace that has been previously initialized."),
+		mcp.WithDescription("Start a local workspace that has been previously initialized. The workspace must be ready, stopped, running or failed to start."),
 		mcp.WithString("projects_directory",
-			mcp.Required(),
-			mcp.Description("The directory where the workspace is located."),
+			mcp.Description("The directory where the workspace is located. Defaults to the projects directory of the session (see set_defaults)."),
 		),
 		mcp.WithString("workspace_name",
 			mcp.Required(),
 			mcp.Description("The name of the workspace to start."),
 		),
-		mcp.WithString("http_port",
-			mcp.Required(),
-			mcp.Description("The port to use for the web IDE. The port must be available in the current directory. It can be any port you want."),
+		mcp.WithNumber("http_port",
+			mcp.Description("The port of the web IDE on the host, to change it. When omitted, the port of the workspace is used."),
+			mcp.Min(1),
+			mcp.Max(65535),
 		),
+		onBusyOption(),
+		asyncOption(),
 	)
+	defaults.declare(startWorkspace)
 	s.AddTool(startWorkspace, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 		args := request.GetArguments()
 		// Check if the required arguments are provided
 		if len(args) == 0 {
-			return mcp.NewToolResultText("Please provide the required arguments: projects_directory, workspace_name"), nil
+			return mcp.NewToolResultError("Please provide the required arguments: projects_directory, workspace_name"), nil
 		}
 		// Extract the arguments
 		projectsDirectory, _ := args["projects_directory"].(string)
 		workspaceName, _ := args["workspace_name"].(string)
-		httpPort, _ := args["http_port"].(string)
+		httpPort := numberArgument(args, "http_port")
 
 		// Check if the required arguments are provided
-		if projectsDirectory == "" || workspaceName == "" || httpPort == "" {
-			return mcp.NewToolResultText("Please provide all the required arguments: projects_directory, workspace_name"), nil
+		if projectsDirectory == "" || workspaceName == "" {
+			return mcp.NewToolResultError("Please provide all the required arguments: projects_directory, workspace_name"), nil
+		}
+
+		options := workspace.StartOptions{
+			ProjectsDirectory: projectsDirectory,
+			WorkspaceName:     workspaceName,
+			HTTPPort:          httpPort,
+			OnBusy:            onBusy(request),
+		}
+		if err := workspace.ValidateStart(options); err != nil {
+			return validationToolResult("start", workspaceName, err), nil
 		}
 
 		// Start the workspace
 		log.Println("Starting workspace", workspaceName, "in directory", projectsDirectory)
 
-		// Set environment variables for the script
-		env := os.Environ()
-		env = append(env, "PROJECTS_DIRECTORY="+projectsDirectory)
-		env = append(env, "WORKSPACE_NAME="+workspaceName)
-		env = append(env, "HTTP_PORT="+httpPort)
+		return runOperation(ctx, request, "start", projectsDirectory, workspaceName, func(ctx context.Context) (*workspace.Result, error) {
+			return engine.Start(ctx, options)
+		}), nil
+	})
+
+	// =================================================
+	// UPDATE WORKSPACE TOOL:
+	// =================================================
+	updateWorkspace := mcp.NewTool("update_workspace",
+		mcp.WithDescription("Change the build args of a workspace, e.g. bump GO_VERSION, then rebuild and (re)start its web IDE. The workspace must be ready, stopped, running or failed to start."),
+		mcp.WithString("projects_directory",
+			mcp.Description("The directory where the workspace is located. Defaults to the projects directory of the session (see set_defaults)."),
+		),
+		mcp.WithString("workspace_name",
+			mcp.Required(),
+			mcp.Description("The name of the workspace to update."),
+		),
+		mcp.WithObject("build_args",
+			mcp.Required(),
+			mcp.Description("The build args to change, by name, e.g. {\"GO_VERSION\": \"1.25.0\"}. Only the build args the Dockerfile of the workspace declares are accepted. An empty value removes an override: the default of the Dockerfile is used again. The other overrides are kept."),
+			mcp.AdditionalProperties(map[string]any{"type": "string"}),
+		),
+		mcp.WithBoolean("rebuild",
+			mcp.Description("Rebuild and (re)start the web IDE with the new build args. When false, they apply at the next start."),
+			mcp.DefaultBool(true),
+		),
+		onBusyOption(),
+		asyncOption(),
+	)
+	defaults.declare(updateWorkspace)
+	s.AddTool(updateWorkspace, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		args := request.GetArguments()
+		// Check if the required arguments are provided
+		if len(args) == 0 {
+			return mcp.NewToolResultError("Please provide the required arguments: projects_directory, workspace_name, build_args"), nil
+		}
+		// Extract the arguments
+		projectsDirectory, _ := args["projects_directory"].(string)
+		workspaceName, _ := args["workspace_name"].(string)
+		buildArgs := stringMapArgument(args, "build_args")
+		rebuild, ok := args["rebuild"].(bool)
+		if !ok {
+			rebuild = true
+		}
 
-		// Execute the start-local-workspace.sh script
-		cmd := exec.Command("./start-local-workspace.sh")
-		cmd.Env = env
+		// Check if the required arguments are provided
+		if projectsDirectory == "" || workspaceName == "" || len(buildArgs) == 0 {
+			return mcp.NewToolResultError("Please provide all the required arguments: projects_directory, workspace_name, build_args"), nil
+		}
 
-		output, err := cmd.CombinedOutput()
-		if err != nil {
-			log.Printf("Error executing start-local-workspace.sh: %v", err)
-			log.Printf("Script output: %s", string(output))
-			return mcp.NewToolResultText(fmt.Sprintf("Failed to start workspace: %v\nOutput: %s", err, string(output))), nil
+		options := workspace.UpdateOptions{
+			ProjectsDirectory: projectsDirectory,
+			WorkspaceName:     workspaceName,
+			BuildArgs:         buildArgs,
+			Rebuild:           rebuild,
+			OnBusy:            onBusy(request),
+		}
+		if err := engine.ValidateUpdate(options); err != nil {
+			return validationToolResult("update", workspaceName, err), nil
 		}
 
-		log.Printf("Workspace start successful. Script output: %s", string(output))
-		return mcp.NewToolResultText(fmt.Sprintf("Workspace %s started successfully!\n\nScript output:\n%s", workspaceName, string(output))), nil
+		// Update the workspace
+		log.Println("Updating workspace", workspaceName, "in directory", projectsDirectory, "with build args", buildArgs)
+
+		return runOperation(ctx, request, "update", projectsDirectory, workspaceName, func(ctx context.Context) (*workspace.Result, error) {
+			return engine.Update(ctx, options)
+		}), nil
 	})
 
 	// =================================================
@@ -198,200 +401,1442 @@ func main() {
 	stopWorkspace := mcp.NewTool("stop_workspace",
 		mcp.WithDescription("Stop a running workspace."),
 		mcp.WithString("projects_directory",
-			mcp.Required(),
-			mcp.Description("The directory where the workspace is located."),
+			mcp.Description("The directory where the workspace is located. Defaults to the projects directory of the session (see set_defaults)."),
 		),
 		mcp.WithString("workspace_name",
 			mcp.Required(),
 			mcp.Description("The name of the workspace to stop."),
 		),
+		onBusyOption(),
+		asyncOption(),
 	)
+	defaults.declare(stopWorkspace)
 	s.AddTool(stopWorkspace, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 		args := request.GetArguments()
 		// Check if the required arguments are provided
 		if len(args) == 0 {
-			return mcp.NewToolResultText("Please provide the required arguments: projects_directory, workspace_name"), nil
+			return mcp.NewToolResultError("Please provide the required arguments: projects_directory, workspace_name"), nil
 		}
 		// Extract the arguments
 		projectsDirectory, _ := args["projects_directory"].(string)
 		workspaceName, _ := args["workspace_name"].(string)
 		// Check if the required arguments are provided
 		if projectsDirectory == "" || workspaceName == "" {
-			return mcp.NewToolResultText("Please provide all the required arguments: projects_directory, workspace_name"), nil
+			return mcp.NewToolResultError("Please provide all the required arguments: projects_directory, workspace_name"), nil
 		}
-		
+
+		options := workspace.StopOptions{
+			ProjectsDirectory: projectsDirectory,
+			WorkspaceName:     workspaceName,
+			OnBusy:            onBusy(request),
+		}
+		if err := workspace.ValidateStop(options); err != nil {
+			return validationToolResult("stop", workspaceName, err), nil
+		}
+
 		// Stop the workspace
 		log.Println("Stopping workspace", workspaceName, "in directory", projectsDirectory)
-		
-		// Set environment variables for the script
-		env := os.Environ()
-		env = append(env, "PROJECTS_DIRECTORY="+projectsDirectory)
-		env = append(env, "WORKSPACE_NAME="+workspaceName)
-
-		// Execute the stop-workspace.sh script
-		cmd := exec.Command("./stop-workspace.sh")
-		cmd.Env = env
-		
-		output, err := cmd.CombinedOutput()
-		if err != nil {
-			log.Printf("Error executing stop-workspace.sh: %v", err)
-			log.Printf("Script output: %s", string(output))
-			return mcp.NewToolResultText(fmt.Sprintf("Failed to stop workspace: %v\nOutput: %s", err, string(output))), nil
-		}
-		
-		log.Printf("Workspace stop successful. Script output: %s", string(output))
-		return mcp.NewToolResultText(fmt.Sprintf("Workspace %s stopped successfully!\n\nScript output:\n%s", workspaceName, string(output))), nil
+
+		return runOperation(ctx, request, "stop", projectsDirectory, workspaceName, func(ctx context.Context) (*workspace.Result, error) {
+			return engine.Stop(ctx, options)
+		}), nil
 	})
 
 	// =================================================
 	// REMOVE WORKSPACE TOOL:
 	// =================================================
 	removeWorkspace := mcp.NewTool("remove_workspace",
-		mcp.WithDescription("Remove a workspace and clean up all associated resources."),
+		mcp.WithDescription("Remove a workspace: its containers (a running workspace is stopped) and networks are removed, then the workspace is moved to the trash, from where restore_workspace can bring it back until it expires. Its volumes, its files and optionally its built images are deleted when the trash is purged, or at once with permanent. Returns a report of what was reclaimed."),
 		mcp.WithString("projects_directory",
-			mcp.Required(),
-			mcp.Description("The directory where the workspace is located."),
+			mcp.Description("The directory where the workspace is located. Defaults to the projects directory of the session (see set_defaults)."),
 		),
 		mcp.WithString("workspace_name",
 			mcp.Required(),
 			mcp.Description("The name of the workspace to remove."),
 		),
+		mcp.WithBoolean("remove_image",
+			mcp.Description("Also remove the images built for the workspace (default false)."),
+		),
+		mcp.WithBoolean("permanent",
+			mcp.Description("Delete the workspace at once instead of moving it to the trash (default false). Its uncommitted changes are lost."),
+		),
+		onBusyOption(),
+		asyncOption(),
 	)
+	defaults.declare(removeWorkspace)
 	s.AddTool(removeWorkspace, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 		args := request.GetArguments()
 		// Check if the required arguments are provided
 		if len(args) == 0 {
-			return mcp.NewToolResultText("Please provide the required arguments: projects_directory, workspace_name"), nil
+			return mcp.NewToolResultError("Please provide the required arguments: projects_directory, workspace_name"), nil
 		}
 		// Extract the arguments
 		projectsDirectory, _ := args["projects_directory"].(string)
 		workspaceName, _ := args["workspace_name"].(string)
 		// Check if the required arguments are provided
 		if projectsDirectory == "" || workspaceName == "" {
-			return mcp.NewToolResultText("Please provide all the required arguments: projects_directory, workspace_name"), nil
+			return mcp.NewToolResultError("Please provide all the required arguments: projects_directory, workspace_name"), nil
+		}
+
+		removeImage, _ := args["remove_image"].(bool)
+		permanent, _ := args["permanent"].(bool)
+		options := workspace.RemoveOptions{
+			ProjectsDirectory: projectsDirectory,
+			WorkspaceName:     workspaceName,
+			RemoveImage:       removeImage,
+			Permanent:         permanent,
+			OnBusy:            onBusy(request),
 		}
-		
+		if err := workspace.ValidateRemove(options); err != nil {
+			return validationToolResult("remove", workspaceName, err), nil
+		}
+
 		// Remove the workspace
 		log.Println("Removing workspace", workspaceName, "in directory", projectsDirectory)
-		
-		// Set environment variables for the script
-		env := os.Environ()
-		env = append(env, "PROJECTS_DIRECTORY="+projectsDirectory)
-		env = append(env, "WORKSPACE_NAME="+workspaceName)
-
-		// Execute the remove-workspace.sh script
-		cmd := exec.Command("./remove-workspace.sh")
-		cmd.Env = env
-		
-		output, err := cmd.CombinedOutput()
-		if err != nil {
-			log.Printf("Error executing remove-workspace.sh: %v", err)
-			log.Printf("Script output: %s", string(output))
-			return mcp.NewToolResultText(fmt.Sprintf("Failed to remove workspace: %v\nOutput: %s", err, string(output))), nil
-		}
-		
-		log.Printf("Workspace removal successful. Script output: %s", string(output))
-		return mcp.NewToolResultText(fmt.Sprintf("Workspace %s removed successfully!\n\nScript output:\n%s", workspaceName, string(output))), nil
+
+		return runOperation(ctx, request, "remove", projectsDirectory, workspaceName, func(ctx context.Context) (*workspace.Result, error) {
+			return engine.Remove(ctx, options)
+		}), nil
 	})
 
 	// =================================================
 	// GET DOCKERFILES LIST TOOL:
 	// =================================================
 	getDockerfilesList := mcp.NewTool("get_dockerfiles_list",
-		mcp.WithDescription("Get list of all Dockerfile files (*.Dockerfile) in the current directory."),
+		mcp.WithDescription("Get the catalog of the Dockerfile templates (*.Dockerfile) to create a workspace: for each template, its display name, language, description, tool versions, build args with their default value, tags, and whether docker-in-docker is enabled. Use it to pick the template matching a repository."),
+		mcp.WithOutputSchema[DockerfilesList](),
 	)
 	s.AddTool(getDockerfilesList, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-		// Get all *.Dockerfile files in current directory
-		files, err := filepath.Glob("*.Dockerfile")
+		// Describe the *.Dockerfile templates from their labels and build args
+		catalog, err := engine.Catalog()
 		if err != nil {
-			log.Printf("Error getting Dockerfile list: %v", err)
-			return mcp.NewToolResultText(fmt.Sprintf("Failed to get Dockerfile list: %v", err)), nil
+			slog.Error(fmt.Sprintf("Error getting Dockerfile list: %v", err))
+			return mcp.NewToolResultError(fmt.Sprintf("Failed to get Dockerfile list: %v", err)), nil
+		}
+		files := make([]string, 0, len(catalog))
+		for _, template := range catalog {
+			files = append(files, template.Name)
 		}
 
 		if len(files) == 0 {
-			return mcp.NewToolResultText("No Dockerfile files found in the current directory."), nil
+			return mcp.NewToolResultStructured(DockerfilesList{Dockerfiles: files, Templates: catalog}, "No Dockerfile files found in the templates directory."), nil
 		}
 
-		// Convert to JSON for structured response
-		jsonFiles, err := json.Marshal(files)
+		// The JSON catalog is the text fallback for the clients ignoring the structured content
+		jsonCatalog, err := json.Marshal(catalog)
 		if err != nil {
-			log.Printf("Error marshaling Dockerfile list: %v", err)
-			return mcp.NewToolResultText(fmt.Sprintf("Found Dockerfiles: %v", files)), nil
+			slog.Error(fmt.Sprintf("Error marshaling Dockerfile list: %v", err))
+			return mcp.NewToolResultStructured(DockerfilesList{Dockerfiles: files, Templates: catalog}, fmt.Sprintf("Found Dockerfiles: %v", files)), nil
 		}
 
 		log.Printf("Found %d Dockerfile(s): %v", len(files), files)
-		return mcp.NewToolResultText(string(jsonFiles)), nil
+		return mcp.NewToolResultStructured(DockerfilesList{Dockerfiles: files, Templates: catalog}, string(jsonCatalog)), nil
 	})
 
 	// =================================================
 	// GET WORKSPACES LIST TOOL:
 	// =================================================
 	getWorkspacesList := mcp.NewTool("get_workspaces_list",
-		mcp.WithDescription("Get list of workspace directories in the specified projects directory (first level only)."),
+		mcp.WithDescription("Get list of the workspaces of the specified projects directory with their metadata (repository, Dockerfile, HTTP port, SSH key name, state, creation and start dates)."),
 		mcp.WithString("projects_directory",
-			mcp.Required(),
-			mcp.Description("The projects directory path to list workspaces from."),
+			mcp.Description("The projects directory path to list workspaces from. Defaults to the projects directory of the session (see set_defaults)."),
 		),
+		mcp.WithOutputSchema[WorkspacesList](),
 	)
+	defaults.declare(getWorkspacesList)
 	s.AddTool(getWorkspacesList, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 		args := request.GetArguments()
 		// Check if the required arguments are provided
 		if len(args) == 0 {
-			return mcp.NewToolResultText("Please provide the required argument: projects_directory"), nil
+			return mcp.NewToolResultError("Please provide the required argument: projects_directory"), nil
 		}
-		
+
 		// Extract the arguments
 		projectsDirectory, _ := args["projects_directory"].(string)
-		
+
 		// Check if the required arguments are provided
 		if projectsDirectory == "" {
-			return mcp.NewToolResultText("Please provide the required argument: projects_directory"), nil
+			return mcp.NewToolResultError("Please provide the required argument: projects_directory"), nil
 		}
 
 		// Check if directory exists
 		if _, err := os.Stat(projectsDirectory); os.IsNotExist(err) {
-			return mcp.NewToolResultText(fmt.Sprintf("Projects directory does not exist: %s", projectsDirectory)), nil
+			return mcp.NewToolResultError(fmt.Sprintf("Projects directory does not exist: %s", projectsDirectory)), nil
 		}
 
-		// Read directory entries
-		entries, err := os.ReadDir(projectsDirectory)
+		// Read the manifests of the workspaces
+		manifests, err := engine.List(projectsDirectory)
 		if err != nil {
-			log.Printf("Error reading projects directory %s: %v", projectsDirectory, err)
-			return mcp.NewToolResultText(fmt.Sprintf("Failed to read projects directory: %v", err)), nil
+			slog.Error(fmt.Sprintf("Error reading projects directory %s: %v", projectsDirectory, err))
+			return mcp.NewToolResultError(fmt.Sprintf("Failed to read projects directory: %v", err)), nil
 		}
 
-		// Filter only directories
-		var directories []string
-		for _, entry := range entries {
-			if entry.IsDir() {
-				directories = append(directories, entry.Name())
+		if len(manifests) == 0 {
+			return mcp.NewToolResultStructured(WorkspacesList{Workspaces: manifests}, fmt.Sprintf("No workspace directories found in: %s", projectsDirectory)), nil
+		}
+
+		// The JSON array is the text fallback for the clients ignoring the structured content
+		jsonManifests, err := json.Marshal(manifests)
+		if err != nil {
+			slog.Error(fmt.Sprintf("Error marshaling workspace list: %v", err))
+			return mcp.NewToolResultStructured(WorkspacesList{Workspaces: manifests}, fmt.Sprintf("Found workspaces: %v", manifests)), nil
+		}
+
+		log.Printf("Found %d workspace(s) in %s", len(manifests), projectsDirectory)
+		return mcp.NewToolResultStructured(WorkspacesList{Workspaces: manifests}, string(jsonManifests)), nil
+	})
+
+	// =================================================
+	// GET WORKSPACE STATUS TOOL:
+	// =================================================
+	getWorkspaceStatus := mcp.NewTool("get_workspace_status",
+		mcp.WithDescription("Get the status of a workspace: its state, and for each compose service the container state, health, published ports, image and uptime, with the URL of the web IDE when it is running."),
+		mcp.WithString("projects_directory",
+			mcp.Description("The directory where the workspace is located. Defaults to the projects directory of the session (see set_defaults)."),
+		),
+		mcp.WithString("workspace_name",
+			mcp.Required(),
+			mcp.Description("The name of the workspace."),
+		),
+		mcp.WithOutputSchema[workspace.Status](),
+	)
+	defaults.declare(getWorkspaceStatus)
+	s.AddTool(getWorkspaceStatus, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		args := request.GetArguments()
+		// Extract the arguments
+		projectsDirectory, _ := args["projects_directory"].(string)
+		workspaceName, _ := args["workspace_name"].(string)
+		// Check if the required arguments are provided
+		if projectsDirectory == "" || workspaceName == "" {
+			return mcp.NewToolResultError("Please provide all the required arguments: projects_directory, workspace_name"), nil
+		}
+
+		status, err := engine.Status(ctx, projectsDirectory, workspaceName)
+		if err != nil {
+			slog.Error(fmt.Sprintf("Error getting status of workspace %s: %v", workspaceName, err))
+			return mcp.NewToolResultError(fmt.Sprintf("Failed to get workspace status: %v", err)), nil
+		}
+		return mcp.NewToolResultStructured(status, status.String()), nil
+	})
+
+	// =================================================
+	// GET WORKSPACES STATUS TOOL:
+	// =================================================
+	getWorkspacesStatus := mcp.NewTool("get_workspaces_status",
+		mcp.WithDescription("Get the status of all the workspaces of the specified projects directory (same information as get_workspace_status for each workspace)."),
+		mcp.WithString("projects_directory",
+			mcp.Description("The projects directory path to list workspaces from. Defaults to the projects directory of the session (see set_defaults)."),
+		),
+		mcp.WithOutputSchema[WorkspacesStatus](),
+	)
+	defaults.declare(getWorkspacesStatus)
+	s.AddTool(getWorkspacesStatus, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		args := request.GetArguments()
+		// Extract the arguments
+		projectsDirectory, _ := args["projects_directory"].(string)
+		// Check if the required arguments are provided
+		if projectsDirectory == "" {
+			return mcp.NewToolResultError("Please provide the required argument: projects_directory"), nil
+		}
+
+		statuses, err := engine.StatusAll(ctx, projectsDirectory)
+		if err != nil {
+			slog.Error(fmt.Sprintf("Error getting status of the workspaces of %s: %v", projectsDirectory, err))
+			return mcp.NewToolResultError(fmt.Sprintf("Failed to get workspaces status: %v", err)), nil
+		}
+		var text strings.Builder
+		for _, status := range statuses {
+			text.WriteString(status.String())
+		}
+		return mcp.NewToolResultStructured(WorkspacesStatus{Workspaces: statuses}, text.String()), nil
+	})
+
+	// =================================================
+	// ADD KNOWN HOST TOOL:
+	// =================================================
+	addKnownHost := mcp.NewTool("add_known_host",
+		mcp.WithDescription("Trust the SSH host keys of a git host: they are written into the known_hosts of the workspaces cloning from it. The keys of github.com, gitlab.com and bitbucket.org are checked against their published fingerprints. Required before creating a workspace cloning with SSH from another host."),
+		mcp.WithString("host",
+			mcp.Required(),
+			mcp.Description("The SSH host name, e.g. gitlab.example.com."),
+		),
+		mcp.WithString("port",
+			mcp.Description("The SSH port of the host, when it is not 22."),
+		),
+		mcp.WithString("fingerprint",
+			mcp.Description("The expected SHA256 fingerprint of a key of the host (SHA256:...), as given by its administrator. Without it, the keys presented by the host are trusted as they are."),
+		),
+		mcp.WithOutputSchema[KnownHostsList](),
+	)
+	s.AddTool(addKnownHost, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		args := request.GetArguments()
+		// Extract the arguments
+		host, _ := args["host"].(string)
+		port, _ := args["port"].(string)
+		fingerprint, _ := args["fingerprint"].(string)
+		// Check if the required arguments are provided
+		if host == "" {
+			return mcp.NewToolResultError("Please provide the required argument: host"), nil
+		}
+		if err := workspace.ValidateKnownHost(host, port); err != nil {
+			return argumentsToolResult("add known host "+host, err), nil
+		}
+
+		knownHosts, err := engine.AddKnownHost(ctx, host, port, fingerprint)
+		if err != nil {
+			slog.Error(fmt.Sprintf("Failed to add known host %s: %v", host, err))
+			return mcp.NewToolResultError(fmt.Sprintf("Failed to add known host %s: %v", host, err)), nil
+		}
+		var text strings.Builder
+		fmt.Fprintf(&text, "✅ Host keys of %s trusted:\n", host)
+		for _, knownHost := range knownHosts {
+			fmt.Fprintf(&text, "- %s %s\n", knownHost.KeyType, knownHost.Fingerprint)
+		}
+		log.Printf("Host keys of %s trusted", host)
+		return mcp.NewToolResultStructured(KnownHostsList{KnownHosts: knownHosts}, text.String()), nil
+	})
+
+	// =================================================
+	// GET KNOWN HOSTS TOOL:
+	// =================================================
+	getKnownHosts := mcp.NewTool("get_known_hosts",
+		mcp.WithDescription("Get the SSH host keys trusted by the server, with their fingerprints."),
+		mcp.WithOutputSchema[KnownHostsList](),
+	)
+	s.AddTool(getKnownHosts, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		knownHosts, err := engine.KnownHosts()
+		if err != nil {
+			slog.Error(fmt.Sprintf("Error reading known hosts: %v", err))
+			return mcp.NewToolResultError(fmt.Sprintf("Failed to read known hosts: %v", err)), nil
+		}
+		var text strings.Builder
+		for _, knownHost := range knownHosts {
+			pinned := ""
+			if knownHost.Pinned {
+				pinned = " (pinned)"
 			}
+			fmt.Fprintf(&text, "- %s %s %s%s\n", knownHost.Host, knownHost.KeyType, knownHost.Fingerprint, pinned)
+		}
+		if len(knownHosts) == 0 {
+			text.WriteString("No known host yet: the keys of github.com, gitlab.com and bitbucket.org are added with the first workspace cloning from them.\n")
+		}
+		return mcp.NewToolResultStructured(KnownHostsList{KnownHosts: knownHosts}, text.String()), nil
+	})
+
+	// =================================================
+	// GET PORT RESERVATIONS TOOL:
+	// =================================================
+	getPortReservations := mcp.NewTool("get_port_reservations",
+		mcp.WithDescription("Get the HTTP ports reserved by the workspaces, and the range of the ports allocated to the new ones."),
+		mcp.WithOutputSchema[PortReservationsList](),
+	)
+	s.AddTool(getPortReservations, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		reservations, err := engine.Ports()
+		if err != nil {
+			slog.Error(fmt.Sprintf("Error reading port reservations: %v", err))
+			return mcp.NewToolResultError(fmt.Sprintf("Failed to read the port reservations: %v", err)), nil
+		}
+		portRange := fmt.Sprintf("%d-%d", engine.PortRangeStart, engine.PortRangeEnd)
+		var text strings.Builder
+		fmt.Fprintf(&text, "Ports allocated from %s:\n", portRange)
+		for _, reservation := range reservations {
+			fmt.Fprintf(&text, "- %d: workspace %s of %s\n", reservation.Port, reservation.WorkspaceName, reservation.ProjectsDirectory)
 		}
+		if len(reservations) == 0 {
+			text.WriteString("No port reserved.\n")
+		}
+		return mcp.NewToolResultStructured(PortReservationsList{Range: portRange, Reservations: reservations}, text.String()), nil
+	})
 
-		if len(directories) == 0 {
-			return mcp.NewToolResultText(fmt.Sprintf("No workspace directories found in: %s", projectsDirectory)), nil
+	// =================================================
+	// SET DEFAULTS TOOL:
+	// =================================================
+	setDefaults := mcp.NewTool("set_defaults",
+		mcp.WithDescription("Set the default values of the arguments of the tools for the session, so that the tool calls only give what varies: the tools use them when the arguments are omitted. An empty value unsets a default of the session, the default of the server applies again. Returns the defaults in effect."),
+		mcp.WithString("projects_directory",
+			mcp.Description("The directory of the workspaces."),
+		),
+		mcp.WithString("git_user_name",
+			mcp.Description("The name of the git user of the new workspaces."),
+		),
+		mcp.WithString("git_user_email",
+			mcp.Description("The email of the git user of the new workspaces."),
+		),
+		mcp.WithString("git_host",
+			mcp.Description("The git host of the new workspaces, e.g. github.com or gitlab.example.com:2222."),
+		),
+		mcp.WithString("key_name",
+			mcp.Description("The name of the SSH key of the new workspaces, in the keys directory."),
+		),
+		mcp.WithString("ssh_auth",
+			mcp.Description("How the new workspaces authenticate to the git host with SSH: key, agent or deploy_key."),
+		),
+		mcp.WithOutputSchema[DefaultsList](),
+	)
+	s.AddTool(setDefaults, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		sessionID := sessionID(ctx)
+		if sessionID == "" {
+			return mcp.NewToolResultError("Failed to set the defaults: no session, the defaults of the server apply"), nil
+		}
+		values := map[string]string{}
+		for name, value := range request.GetArguments() {
+			values[name], _ = value.(string)
+		}
+		if err := workspace.ValidateDefaults(values); err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Failed to set the defaults: %v", err)), nil
 		}
+		defaults.set(sessionID, values)
+		log.Printf("Defaults of session %s set: %v", sessionID, values)
+		list := defaults.list(ctx)
+		return mcp.NewToolResultStructured(DefaultsList{Defaults: list}, "Defaults set:\n"+defaultsText(list)), nil
+	})
+
+	// =================================================
+	// GET DEFAULTS TOOL:
+	// =================================================
+	getDefaults := mcp.NewTool("get_defaults",
+		mcp.WithDescription("Get the default values of the arguments of the tools for the session, and where they come from: the session (set_defaults) or the server."),
+		mcp.WithOutputSchema[DefaultsList](),
+	)
+	s.AddTool(getDefaults, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		list := defaults.list(ctx)
+		return mcp.NewToolResultStructured(DefaultsList{Defaults: list}, defaultsText(list)), nil
+	})
 
-		// Convert to JSON for structured response
-		jsonDirs, err := json.Marshal(directories)
+	// =================================================
+	// LIST TRASHED WORKSPACES TOOL:
+	// =================================================
+	listTrashedWorkspaces := mcp.NewTool("list_trashed_workspaces",
+		mcp.WithDescription("List the removed workspaces kept in the trash, the most recently removed first, with the date they expire and are purged."),
+		mcp.WithString("projects_directory",
+			mcp.Description("Only list the workspaces removed from this directory (default: all)."),
+		),
+		mcp.WithOutputSchema[TrashList](),
+	)
+	s.AddTool(listTrashedWorkspaces, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		projectsDirectory, _ := request.GetArguments()["projects_directory"].(string)
+		if projectsDirectory != "" {
+			if err := workspace.ValidateProjectsDirectory(projectsDirectory); err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+		}
+		entries, err := engine.Trash(projectsDirectory)
 		if err != nil {
-			log.Printf("Error marshaling workspace list: %v", err)
-			return mcp.NewToolResultText(fmt.Sprintf("Found workspaces: %v", directories)), nil
+			slog.Error(fmt.Sprintf("Error reading the trash: %v", err))
+			return mcp.NewToolResultError(fmt.Sprintf("Failed to read the trash: %v", err)), nil
+		}
+		var text strings.Builder
+		for _, entry := range entries {
+			fmt.Fprintf(&text, "- %s: workspace %s of %s, removed %s, expires %s\n", entry.ID, entry.WorkspaceName, entry.ProjectsDirectory,
+				entry.TrashedAt.Local().Format(time.DateTime), entry.ExpiresAt.Local().Format(time.DateTime))
+		}
+		if len(entries) == 0 {
+			text.WriteString("The trash is empty.\n")
 		}
+		return mcp.NewToolResultStructured(TrashList{Trash: entries}, text.String()), nil
+	})
 
-		log.Printf("Found %d workspace(s) in %s: %v", len(directories), projectsDirectory, directories)
-		return mcp.NewToolResultText(string(jsonDirs)), nil
+	// =================================================
+	// RESTORE WORKSPACE TOOL:
+	// =================================================
+	restoreWorkspace := mcp.NewTool("restore_workspace",
+		mcp.WithDescription("Restore a removed workspace from the trash into its projects directory. The workspace is stopped: start it with start_workspace. It gets back its HTTP port, or a new one if the port was taken meanwhile."),
+		mcp.WithString("trash_id",
+			mcp.Required(),
+			mcp.Description("The id of the workspace in the trash, see list_trashed_workspaces."),
+		),
+		onBusyOption(),
+		asyncOption(),
+	)
+	s.AddTool(restoreWorkspace, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		trashID, _ := request.GetArguments()["trash_id"].(string)
+		if trashID == "" {
+			return mcp.NewToolResultError("Please provide the required argument: trash_id"), nil
+		}
+		options := workspace.RestoreOptions{
+			TrashID: trashID,
+			OnBusy:  onBusy(request),
+		}
+		if err := workspace.ValidateRestore(options); err != nil {
+			return validationToolResult("restore", trashID, err), nil
+		}
+		log.Println("Restoring workspace", trashID, "from the trash")
+		workspaceName, projectsDirectory := trashedWorkspace(engine, trashID)
+		return runOperation(ctx, request, "restore", projectsDirectory, workspaceName, func(ctx context.Context) (*workspace.Result, error) {
+			return engine.Restore(ctx, options)
+		}), nil
 	})
 
-	// Start the HTTP server
-	httpPort := os.Getenv("HTTP_PORT")
-	if httpPort == "" {
-		httpPort = "9090"
-	}
+	// =================================================
+	// PURGE TRASH TOOL:
+	// =================================================
+	purgeTrash := mcp.NewTool("purge_trash",
+		mcp.WithDescription("Delete removed workspaces from the trash for good: their files, their volumes, and their images when remove_image was set at removal. Without trash_id, all the workspaces of the trash are purged. The expired ones are purged in the background anyway."),
+		mcp.WithString("trash_id",
+			mcp.Description("The id of the workspace to purge, see list_trashed_workspaces (default: all)."),
+		),
+		mcp.WithString("projects_directory",
+			mcp.Description("Only purge the workspaces removed from this directory (default: all)."),
+		),
+		mcp.WithBoolean("expired_only",
+			mcp.Description("Only purge the workspaces whose retention expired (default false)."),
+		),
+		onBusyOption(),
+		asyncOption(),
+	)
+	s.AddTool(purgeTrash, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		args := request.GetArguments()
+		trashID, _ := args["trash_id"].(string)
+		projectsDirectory, _ := args["projects_directory"].(string)
+		expiredOnly, _ := args["expired_only"].(bool)
+		options := workspace.PurgeOptions{
+			ProjectsDirectory: projectsDirectory,
+			TrashID:           trashID,
+			ExpiredOnly:       expiredOnly,
+			OnBusy:            onBusy(request),
+		}
+		if err := workspace.ValidatePurge(options); err != nil {
+			return validationToolResult("purge", trashID, err), nil
+		}
+		log.Println("Purging the trash", trashID)
+		// the job of a purge of several workspaces is the one of the trash
+		workspaceName := workspace.TrashDirectoryName
+		if trashID != "" {
+			workspaceName, projectsDirectory = trashedWorkspace(engine, trashID)
+		}
+		return runOperation(ctx, request, "purge", projectsDirectory, workspaceName, func(ctx context.Context) (*workspace.Result, error) {
+			return engine.PurgeTrash(ctx, options)
+		}), nil
+	})
 
-	log.Println("MCP StreamableHTTP server is running on port", httpPort)
+	// =================================================
+	// GET JOB STATUS TOOL:
+	// =================================================
+	getJobStatus := mcp.NewTool("get_job_status",
+		mcp.WithDescription("Get the status of a background job (an operation run with async): running, succeeded, failed, cancelled or interrupted (the server stopped during the job), its progress and, once finished, the result of the operation."),
+		mcp.WithString("job_id",
+			mcp.Required(),
+			mcp.Description("The id of the job, returned by the tool which submitted it."),
+		),
+		mcp.WithOutputSchema[workspace.Job](),
+	)
+	s.AddTool(getJobStatus, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		jobID, _ := request.GetArguments()["job_id"].(string)
+		if jobID == "" {
+			return mcp.NewToolResultError("Please provide the required argument: job_id"), nil
+		}
+		job, err := jobs.Get(jobID)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Failed to get job %s: %v", jobID, err)), nil
+		}
+		return mcp.NewToolResultStructured(job, job.String()), nil
+	})
 
-	server.NewStreamableHTTPServer(s,
-		server.WithEndpointPath("/mcp"),
-	).Start(":" + httpPort)
+	// =================================================
+	// LIST JOBS TOOL:
+	// =================================================
+	listJobs := mcp.NewTool("list_jobs",
+		mcp.WithDescription("List the background jobs, the most recent first. The history is kept across the restarts of the server."),
+		mcp.WithString("workspace_name",
+			mcp.Description("Only list the jobs of this workspace."),
+		),
+		mcp.WithString("status",
+			mcp.Description("Only list the jobs with this status."),
+			mcp.Enum("running", "succeeded", "failed", "cancelled", "interrupted"),
+		),
+		mcp.WithOutputSchema[JobsList](),
+	)
+	s.AddTool(listJobs, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		args := request.GetArguments()
+		workspaceName, _ := args["workspace_name"].(string)
+		status, _ := args["status"].(string)
+		list := jobs.List(workspaceName, workspace.JobStatus(status))
+		var text strings.Builder
+		for _, job := range list {
+			fmt.Fprintf(&text, "- %s: %s workspace %s, %s (created at %s)\n", job.ID, job.Action, job.WorkspaceName, job.Status, job.CreatedAt.Format(time.RFC3339))
+		}
+		if len(list) == 0 {
+			text.WriteString("No job found.\n")
+		}
+		return mcp.NewToolResultStructured(JobsList{Jobs: list}, text.String()), nil
+	})
+
+	// =================================================
+	// CANCEL JOB TOOL:
+	// =================================================
+	cancelJob := mcp.NewTool("cancel_job",
+		mcp.WithDescription("Cancel a running background job: its commands are killed and the operation is rolled back. The job is cancelled once the rollback is done, check it with get_job_status."),
+		mcp.WithString("job_id",
+			mcp.Required(),
+			mcp.Description("The id of the job to cancel."),
+		),
+		mcp.WithOutputSchema[workspace.Job](),
+	)
+	s.AddTool(cancelJob, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		jobID, _ := request.GetArguments()["job_id"].(string)
+		if jobID == "" {
+			return mcp.NewToolResultError("Please provide the required argument: job_id"), nil
+		}
+		job, err := jobs.Cancel(jobID)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Failed to cancel job %s: %v", jobID, err)), nil
+		}
+		if job.Finished() {
+			return mcp.NewToolResultError(fmt.Sprintf("Job %s is not running, it is %s", jobID, job.Status)), nil
+		}
+		log.Printf("Job %s cancelled", jobID)
+		return mcp.NewToolResultStructured(job, fmt.Sprintf("Cancellation of job %s requested.\n", jobID)), nil
+	})
+
+	// =================================================
+	// GET JOB LOG TOOL:
+	// =================================================
+	getJobLog := mcp.NewTool("get_job_log",
+		mcp.WithDescription("Get the log of a background job: the output of its commands (git clone, docker build), line by line, the errors prefixed with ERROR."),
+		mcp.WithString("job_id",
+			mcp.Required(),
+			mcp.Description("The id of the job."),
+		),
+		mcp.WithNumber("lines",
+			mcp.Description("Only return the last lines of the log."),
+		),
+	)
+	s.AddTool(getJobLog, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		args := request.GetArguments()
+		jobID, _ := args["job_id"].(string)
+		lines, _ := args["lines"].(float64)
+		if jobID == "" {
+			return mcp.NewToolResultError("Please provide the required argument: job_id"), nil
+		}
+		output, err := jobs.Log(jobID, int(lines))
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Failed to read the log of job %s: %v", jobID, err)), nil
+		}
+		if output == "" {
+			output = fmt.Sprintf("The log of job %s is empty.\n", jobID)
+		}
+		return mcp.NewToolResultText(output), nil
+	})
+
+	// =================================================
+	// RESOURCES:
+	// =================================================
+	// The workspaces resources are read from the projects directory of the session
+	templatesResource := mcp.NewResource("codex://templates", "templates",
+		mcp.WithResourceDescription("The list of the templates (Dockerfiles and compose files) available to create a workspace."),
+		mcp.WithMIMEType("application/json"),
+	)
+	s.AddResource(templatesResource, func(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+		templates, err := engine.Templates()
+		if err != nil {
+			return nil, err
+		}
+		return jsonResource(request.Params.URI, templates)
+	})
+
+	templateResource := mcp.NewResourceTemplate("codex://templates/{name}", "template",
+		mcp.WithTemplateDescription("The content of a template (e.g. golang.Dockerfile, compose.yml)."),
+		mcp.WithTemplateMIMEType("text/plain"),
+	)
+	s.AddResourceTemplate(templateResource, func(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+		name := resourceArgument(request, "name")
+		content, err := engine.ReadTemplate(name)
+		if err != nil {
+			return nil, err
+		}
+		return textResource(request.Params.URI, "text/plain", content), nil
+	})
+
+	workspacesResource := mcp.NewResource("codex://workspaces", "workspaces",
+		mcp.WithResourceDescription("The manifests of the workspaces of the projects directory of the session ("+serverDefaults["projects_directory"]+" by default, see set_defaults)."),
+		mcp.WithMIMEType("application/json"),
+	)
+	s.AddResource(workspacesResource, func(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+		manifests, err := engine.List(defaults.get(ctx, "projects_directory"))
+		if err != nil {
+			return nil, err
+		}
+		return jsonResource(request.Params.URI, manifests)
+	})
+
+	workspaceFiles := []struct {
+		file        string
+		mimeType    string
+		description string
+	}{
+		{"compose.yml", "application/yaml", "The compose file of a workspace."},
+		{"Dockerfile", "text/plain", "The Dockerfile of a workspace."},
+		{"manifest", "application/json", "The manifest of a workspace: repository, template, port, state and dates."},
+		{"build-log", "text/plain", "The output of the last build of a workspace (start_workspace)."},
+	}
+	for _, workspaceFile := range workspaceFiles {
+		resource := mcp.NewResourceTemplate("codex://workspaces/{name}/"+workspaceFile.file, "workspace "+workspaceFile.file,
+			mcp.WithTemplateDescription(workspaceFile.description),
+			mcp.WithTemplateMIMEType(workspaceFile.mimeType),
+		)
+		s.AddResourceTemplate(resource, func(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+			name := resourceArgument(request, "name")
+			content, err := engine.ReadWorkspaceFile(defaults.get(ctx, "projects_directory"), name, workspaceFile.file)
+			if err != nil {
+				return nil, err
+			}
+			return textResource(request.Params.URI, workspaceFile.mimeType, content), nil
+		})
+	}
+
+	// =================================================
+	// PROMPTS:
+	// =================================================
+	createWorkspaceFromRepo := mcp.NewPrompt("create_workspace_from_repo",
+		mcp.WithPromptDescription("Create and start a workspace for a git repository, choosing the template matching its language."),
+		mcp.WithArgument("repository",
+			mcp.RequiredArgument(),
+			mcp.ArgumentDescription("The repository to clone: owner/project.git on the git host, or a full clone URL."),
+		),
+		mcp.WithArgument("workspace_name",
+			mcp.ArgumentDescription("The name of the workspace (by default, the name of the project)."),
+		),
+		mcp.WithArgument("dockerfile_name",
+			mcp.ArgumentDescription("The template of the workspace, e.g. golang.Dockerfile (by default, chosen from the language of the repository)."),
+		),
+		mcp.WithArgument("git_user_name",
+			mcp.ArgumentDescription("The name of the git user."),
+		),
+		mcp.WithArgument("git_user_email",
+			mcp.ArgumentDescription("The email of the git user."),
+		),
+		mcp.WithArgument("http_port",
+			mcp.ArgumentDescription("The port of the web IDE (by default, allocated by the server)."),
+		),
+		mcp.WithArgument("ssh_auth",
+			mcp.ArgumentDescription("key, agent or deploy_key."),
+		),
+	)
+	s.AddPrompt(createWorkspaceFromRepo, func(ctx context.Context, request mcp.GetPromptRequest) (*mcp.GetPromptResult, error) {
+		args := request.Params.Arguments
+		if args["repository"] == "" {
+			return nil, fmt.Errorf("the repository argument is required")
+		}
+		catalog, err := engine.Catalog()
+		if err != nil {
+			return nil, err
+		}
+		projectsDirectory := defaults.get(ctx, "projects_directory")
+		var text strings.Builder
+		fmt.Fprintf(&text, "Create a workspace for the repository %s with the initializer_workspace tool, then start it with the start_workspace tool.\n\n", args["repository"])
+		text.WriteString("Use these parameters:\n")
+		for _, name := range []string{"workspace_name", "dockerfile_name", "git_user_name", "git_user_email", "http_port", "ssh_auth"} {
+			value := args[name]
+			if value == "" && slices.Contains(defaultArguments, name) {
+				value = defaults.get(ctx, name)
+			}
+			if value != "" {
+				fmt.Fprintf(&text, "- %s: %s\n", name, value)
+			}
+		}
+		fmt.Fprintf(&text, "- projects_directory: %s\n- compose_file_name: %s\n- offload_override_name: %s\n\n", projectsDirectory, workspace.DefaultComposeFileName, workspace.DefaultOffloadOverrideName)
+		text.WriteString("The available templates are:\n")
+		for _, template := range catalog {
+			fmt.Fprintf(&text, "- %s: %s", template.Name, template.DisplayName)
+			if template.Language != "" {
+				fmt.Fprintf(&text, " (%s)", template.Language)
+			}
+			if template.Description != "" {
+				fmt.Fprintf(&text, ", %s", template.Description)
+			}
+			if len(template.Tags) > 0 {
+				fmt.Fprintf(&text, " [%s]", strings.Join(template.Tags, ", "))
+			}
+			text.WriteString("\n")
+		}
+		if args["dockerfile_name"] == "" {
+			text.WriteString("Choose the template matching the language of the repository from its language and tags (read the templates with the codex://templates/{name} resources if needed), or ask me when none matches.\n")
+		}
+		if args["workspace_name"] == "" {
+			text.WriteString("Name the workspace after the project of the repository.\n")
+		}
+		text.WriteString("Ask me the missing required parameters (git user name and email, SSH key name to clone with SSH) before calling the tools. ")
+		text.WriteString("If the creation returns a deploy key, give it to me and wait for my confirmation before starting the workspace. Finally, give me the URL of the web IDE.\n")
+
+		return mcp.NewGetPromptResult(
+			"Create a workspace for "+args["repository"],
+			[]mcp.PromptMessage{mcp.NewPromptMessage(mcp.RoleUser, mcp.NewTextContent(text.String()))},
+		), nil
+	})
+
+	troubleshootWorkspace := mcp.NewPrompt("troubleshoot_workspace",
+		mcp.WithPromptDescription("Diagnose a workspace that does not start or does not work, from its state, its containers and its build log."),
+		mcp.WithArgument("workspace_name",
+			mcp.RequiredArgument(),
+			mcp.ArgumentDescription("The name of the workspace to diagnose."),
+		),
+	)
+	s.AddPrompt(troubleshootWorkspace, func(ctx context.Context, request mcp.GetPromptRequest) (*mcp.GetPromptResult, error) {
+		workspaceName := request.Params.Arguments["workspace_name"]
+		if workspaceName == "" {
+			return nil, fmt.Errorf("the workspace_name argument is required")
+		}
+		projectsDirectory := defaults.get(ctx, "projects_directory")
+		status, err := engine.Status(ctx, projectsDirectory, workspaceName)
+		if err != nil {
+			return nil, err
+		}
+		messages := []mcp.PromptMessage{
+			mcp.NewPromptMessage(mcp.RoleUser, mcp.NewTextContent(fmt.Sprintf(
+				"The workspace %s does not work as expected. Find out why from its status, its manifest and its build log below, explain the cause and propose a fix. "+
+					"You can use the get_workspace_status, start_workspace, stop_workspace and remove_workspace tools, but ask me before changing anything.\n\nStatus:\n%s",
+				workspaceName, status))),
+		}
+		// the files of the workspace, when they exist
+		for _, file := range []string{"manifest", "build-log", "compose.yml"} {
+			content, err := engine.ReadWorkspaceFile(projectsDirectory, workspaceName, file)
+			if err != nil {
+				continue
+			}
+			messages = append(messages, mcp.NewPromptMessage(mcp.RoleUser, mcp.NewEmbeddedResource(mcp.TextResourceContents{
+				URI:      "codex://workspaces/" + workspaceName + "/" + file,
+				MIMEType: "text/plain",
+				Text:     string(content),
+			})))
+		}
+		return mcp.NewGetPromptResult("Troubleshoot the workspace "+workspaceName, messages), nil
+	})
+
+	cleanupStaleWorkspaces := mcp.NewPrompt("cleanup_stale_workspaces",
+		mcp.WithPromptDescription("Find the failed workspaces and the ones unused for a while, and remove them after confirmation."),
+		mcp.WithArgument("days",
+			mcp.ArgumentDescription("Number of days without start or stop after which a workspace is stale (30 by default)."),
+		),
+	)
+	s.AddPrompt(cleanupStaleWorkspaces, func(ctx context.Context, request mcp.GetPromptRequest) (*mcp.GetPromptResult, error) {
+		days := 30
+		if value := request.Params.Arguments["days"]; value != "" {
+			if _, err := fmt.Sscanf(value, "%d", &days); err != nil || days < 0 {
+				return nil, fmt.Errorf("days must be a positive number of days: %s", value)
+			}
+		}
+		projectsDirectory := defaults.get(ctx, "projects_directory")
+		manifests, err := engine.List(projectsDirectory)
+		if err != nil {
+			return nil, err
+		}
+		limit := time.Now().AddDate(0, 0, -days)
+		var stale strings.Builder
+		for _, manifest := range manifests {
+			lastActivity := manifest.LastActivity()
+			switch {
+			case manifest.State == workspace.StateFailed:
+				fmt.Fprintf(&stale, "- %s: failed during %s (%s)\n", manifest.WorkspaceName, manifest.FailedAction, manifest.LastError)
+			case manifest.State == workspace.StateUnknown:
+				fmt.Fprintf(&stale, "- %s: no manifest, unknown state\n", manifest.WorkspaceName)
+			case manifest.State != workspace.StateRunning && lastActivity.IsZero():
+				fmt.Fprintf(&stale, "- %s: %s, never used\n", manifest.WorkspaceName, manifest.State)
+			case manifest.State != workspace.StateRunning && lastActivity.Before(limit):
+				fmt.Fprintf(&stale, "- %s: %s, last used on %s\n", manifest.WorkspaceName, manifest.State, lastActivity.Format(time.DateOnly))
+			}
+		}
+		text := fmt.Sprintf("There is no stale workspace in %s (failed, or not started nor stopped for %d days). Tell me so.", projectsDirectory, days)
+		if stale.Len() > 0 {
+			text = fmt.Sprintf("These workspaces of %s are failed, or were not started nor stopped for %d days:\n%s\n"+
+				"Show me this list and ask me which ones to remove. Then remove the ones I confirm with the remove_workspace tool (ask me whether to remove their images too), and report what was reclaimed.",
+				projectsDirectory, days, stale.String())
+		}
+		return mcp.NewGetPromptResult(
+			"Clean up the stale workspaces",
+			[]mcp.PromptMessage{mcp.NewPromptMessage(mcp.RoleUser, mcp.NewTextContent(text))},
+		), nil
+	})
+
+	// The expired workspaces of the trash are purged in the background
+	go purgeExpiredTrash(engine, config.toolTimeouts["purge_trash"])
+
+	// Start the HTTP server
+	log.Printf("MCP StreamableHTTP server is running on %s%s (templates: embedded, overridden by %s)", config.ListenAddress, config.EndpointPath, config.TemplatesDirectory)
+
+	mux := http.NewServeMux()
+	// the arguments of the prompts and resource templates are completed before the MCP server (see completer)
+	completions := &completer{engine: engine, defaults: defaults}
+	mux.Handle(config.EndpointPath, allowHosts(config.AllowedHosts, defaults.forgetOnDelete(completions.middleware(server.NewStreamableHTTPServer(s,
+		server.WithEndpointPath(config.EndpointPath),
+	)))))
+	if err := http.ListenAndServe(config.ListenAddress, mux); err != nil {
+		fatalf("MCP server stopped: %v", err)
+	}
+}
+
+// The structured outputs of the tools.
+// The structured content of a tool must be an object: the lists are wrapped.
+
+// DockerfilesList is the output of the get_dockerfiles_list tool.
+type DockerfilesList struct {
+	Dockerfiles []string                 `json:"dockerfiles"` // the names of the templates
+	Templates   []workspace.TemplateInfo `json:"templates"`
+}
+
+// WorkspacesList is the output of the get_workspaces_list tool.
+type WorkspacesList struct {
+	Workspaces []workspace.Manifest `json:"workspaces"`
+}
+
+// WorkspacesStatus is the output of the get_workspaces_status tool.
+type WorkspacesStatus struct {
+	Workspaces []workspace.Status `json:"workspaces"`
+}
+
+// KnownHostsList is the output of the add_known_host and get_known_hosts tools.
+type KnownHostsList struct {
+	KnownHosts []workspace.KnownHost `json:"known_hosts"`
+}
+
+// PortReservationsList is the output of the get_port_reservations tool.
+type PortReservationsList struct {
+	Range        string                      `json:"range"`
+	Reservations []workspace.PortReservation `json:"reservations"`
+}
+
+// TrashList is the output of the list_trashed_workspaces tool.
+type TrashList struct {
+	Trash []workspace.TrashEntry `json:"trash"`
+}
+
+// DefaultsList is the output of the set_defaults and get_defaults tools.
+type DefaultsList struct {
+	Defaults []ArgumentDefault `json:"defaults"`
+}
+
+// ArgumentDefault is the default value of an argument of the tools.
+type ArgumentDefault struct {
+	Argument string `json:"argument"`
+	Value    string `json:"value"`
+	Source   string `json:"source"` // session or server
+}
+
+// JobsList is the output of the list_jobs tool.
+type JobsList struct {
+	Jobs []workspace.Job `json:"jobs"`
+}
+
+// toolReporter sends the progress of a workspace operation to the MCP client while it runs:
+// progress notifications when the client asked for them with a progress token,
+// and logging notifications with the output of the commands (docker build, git clone).
+type toolReporter struct {
+	ctx    context.Context
+	server *server.MCPServer
+	token  mcp.ProgressToken
+	logger string
+}
+
+func newToolReporter(ctx context.Context, s *server.MCPServer, request mcp.CallToolRequest, logger string) *toolReporter {
+	reporter := &toolReporter{ctx: ctx, server: s, logger: logger}
+	if request.Params.Meta != nil {
+		reporter.token = request.Params.Meta.ProgressToken
+	}
+	return reporter
+}
+
+func (r *toolReporter) Progress(progress, total float64, message string) {
+	if r.token == nil {
+		return
+	}
+	err := r.server.SendNotificationToClient(r.ctx, "notifications/progress", map[string]any{
+		"progressToken": r.token,
+		"progress":      progress,
+		"total":         total,
+		"message":       message,
+	})
+	if err != nil {
+		slog.Error(fmt.Sprintf("Failed to send progress of %s: %v", r.logger, err))
+	}
+}
+
+func (r *toolReporter) Log(level workspace.LogLevel, step, line string) {
+	// the client chooses the level of the messages it receives (logging/setLevel)
+	notification := mcp.NewLoggingMessageNotification(mcp.LoggingLevel(level), r.logger, step+": "+line)
+	if err := r.server.SendLogMessageToClient(r.ctx, notification); err != nil {
+		slog.Error(fmt.Sprintf("Failed to send log of %s: %v", r.logger, err))
+	}
+}
+
+// parsePortRange parses a range of ports: <start>-<end>.
+func parsePortRange(value string) (int, int, error) {
+	first, last, ok := strings.Cut(value, "-")
+	if !ok {
+		return 0, 0, fmt.Errorf("expected <start>-<end>")
+	}
+	start, err := strconv.Atoi(strings.TrimSpace(first))
+	if err != nil {
+		return 0, 0, err
+	}
+	end, err := strconv.Atoi(strings.TrimSpace(last))
+	if err != nil {
+		return 0, 0, err
+	}
+	if start < 1 || end > 65535 || start > end {
+		return 0, 0, fmt.Errorf("expected 1 <= start <= end <= 65535")
+	}
+	return start, end, nil
+}
+
+// defaultToolTimeouts are the timeouts of the tools running commands.
+// The other tools can only be cancelled.
+var defaultToolTimeouts = map[string]time.Duration{
+	"initializer_workspace": 10 * time.Minute,
+	"start_workspace":       30 * time.Minute, // docker compose up --build
+	"update_workspace":      30 * time.Minute, // docker compose up --build with the new build args
+	"stop_workspace":        5 * time.Minute,
+	"remove_workspace":      5 * time.Minute,
+	"get_workspace_status":  time.Minute,
+	"get_workspaces_status": 5 * time.Minute,
+	"add_known_host":        time.Minute,
+	"restore_workspace":     time.Minute,
+	"purge_trash":           10 * time.Minute,
+}
+
+// trashPurgeInterval is the period of the background purge of the trash.
+const trashPurgeInterval = time.Hour
+
+// purgeExpiredTrash purges the expired workspaces of the trash at start, then every trashPurgeInterval,
+// each purge running at most timeout, the one of purge_trash (0 for no timeout).
+func purgeExpiredTrash(engine *workspace.Engine, timeout time.Duration) {
+	for {
+		ctx, cancel := context.Background(), context.CancelFunc(func() {})
+		if timeout > 0 {
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+		}
+		result, err := engine.PurgeTrash(ctx, workspace.PurgeOptions{ExpiredOnly: true})
+		cancel()
+		for _, step := range result.Steps {
+			log.Printf("🧹 Trash: %s", step.Message)
+		}
+		if err != nil {
+			slog.Error(fmt.Sprintf("Failed to purge the expired workspaces of the trash: %v", err))
+		}
+		time.Sleep(trashPurgeInterval)
+	}
+}
+
+// requestIDField is the field of the _meta of a tool call holding its JSON-RPC id,
+// which the tool handlers do not receive otherwise.
+const requestIDField = "compose-codex/requestId"
+
+// toolCalls makes the tool calls cancellable: by the client with a notifications/cancelled,
+// or by the timeout of the tool. The context of a call is also done when the client disconnects.
+// The workspace operations then kill their commands and roll back (see workspace.ErrCancelled).
+type toolCalls struct {
+	timeouts map[string]time.Duration
+	mutex    sync.Mutex
+	cancels  map[string]context.CancelCauseFunc // by session and request id
+}
+
+func newToolCalls(timeouts map[string]time.Duration) *toolCalls {
+	return &toolCalls{timeouts: timeouts, cancels: map[string]context.CancelCauseFunc{}}
+}
+
+// sessionID returns the id of the MCP session of a request, empty without session.
+func sessionID(ctx context.Context) string {
+	if session := server.ClientSessionFromContext(ctx); session != nil {
+		return session.SessionID()
+	}
+	return ""
+}
+
+func callKey(ctx context.Context, id any) string {
+	return fmt.Sprintf("%s/%v", sessionID(ctx), id)
+}
+
+// identify records the request id of a tool call in its _meta, for the middleware.
+func (c *toolCalls) identify(ctx context.Context, id any, request *mcp.CallToolRequest) {
+	if request.Params.Meta == nil {
+		request.Params.Meta = &mcp.Meta{}
+	}
+	if request.Params.Meta.AdditionalFields == nil {
+		request.Params.Meta.AdditionalFields = map[string]any{}
+	}
+	request.Params.Meta.AdditionalFields[requestIDField] = id
+}
+
+// middleware runs a tool handler with a context done on cancellation or timeout.
+func (c *toolCalls) middleware(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		tool := request.Params.Name
+		slog.Debug("Tool call", "tool", tool, "session", sessionID(ctx), "arguments", slices.Sorted(maps.Keys(request.GetArguments())))
+		ctx, cancel := context.WithCancelCause(ctx)
+		defer cancel(nil)
+		if timeout := c.timeouts[tool]; timeout > 0 {
+			var stop context.CancelFunc
+			ctx, stop = context.WithTimeoutCause(ctx, timeout, fmt.Errorf("%s timed out after %s", tool, timeout))
+			defer stop()
+		}
+
+		if request.Params.Meta != nil {
+			if id, ok := request.Params.Meta.AdditionalFields[requestIDField]; ok {
+				key := callKey(ctx, id)
+				c.mutex.Lock()
+				c.cancels[key] = cancel
+				c.mutex.Unlock()
+				defer func() {
+					c.mutex.Lock()
+					delete(c.cancels, key)
+					c.mutex.Unlock()
+				}()
+			}
+		}
+
+		result, err := next(ctx, request)
+		if ctx.Err() != nil {
+			log.Printf("Tool %s cancelled: %v", tool, context.Cause(ctx))
+		}
+		return result, err
+	}
+}
+
+// cancel handles the notifications/cancelled of the clients.
+func (c *toolCalls) cancel(ctx context.Context, notification mcp.JSONRPCNotification) {
+	id := notification.Params.AdditionalFields["requestId"]
+	reason, _ := notification.Params.AdditionalFields["reason"].(string)
+	if reason == "" {
+		reason = "no reason given"
+	}
+	c.mutex.Lock()
+	cancel, ok := c.cancels[callKey(ctx, id)]
+	c.mutex.Unlock()
+	if ok {
+		cancel(fmt.Errorf("cancelled by the client: %s", reason))
+	}
+}
+
+// defaultArguments are the arguments of the tools which take a default value when they are omitted:
+// the default of the session, set with the set_defaults tool, or else the default of the server.
+var defaultArguments = []string{"projects_directory", "git_user_name", "git_user_email", "git_host", "key_name", "ssh_auth"}
+
+// sessionDefaultsExpiration is how long the defaults of an unused session are kept,
+// for the clients leaving without terminating their session.
+const sessionDefaultsExpiration = 24 * time.Hour
+
+// loadServerDefaults returns the defaults of the server: the projects directory of the configuration
+// and the DEFAULT_<ARGUMENT> environment variables, e.g. DEFAULT_GIT_USER_EMAIL.
+func loadServerDefaults(projectsDirectory string) (map[string]string, error) {
+	defaults := map[string]string{
+		"projects_directory": projectsDirectory,
+		"git_host":           workspace.DefaultGitHost,
+		"ssh_auth":           string(workspace.SSHAuthKey),
+	}
+	for _, argument := range defaultArguments {
+		if value := os.Getenv("DEFAULT_" + strings.ToUpper(argument)); value != "" {
+			defaults[argument] = value
+		}
+	}
+	return defaults, workspace.ValidateDefaults(defaults)
+}
+
+// toolDefaults fills the arguments omitted by the tool calls with the defaults of their session,
+// or else with the defaults of the server.
+type toolDefaults struct {
+	server    map[string]string
+	arguments map[string][]string // the arguments taking a default, by tool
+	mutex     sync.Mutex
+	sessions  map[string]*sessionDefaults // by session id
+}
+
+type sessionDefaults struct {
+	values   map[string]string
+	lastUsed time.Time
+}
+
+func newToolDefaults(server map[string]string) *toolDefaults {
+	return &toolDefaults{server: server, arguments: map[string][]string{}, sessions: map[string]*sessionDefaults{}}
+}
+
+// declare records the arguments of a tool taking a default. The tools are declared before serving.
+func (d *toolDefaults) declare(tool mcp.Tool) {
+	for _, argument := range defaultArguments {
+		if _, ok := tool.InputSchema.Properties[argument]; ok {
+			d.arguments[tool.Name] = append(d.arguments[tool.Name], argument)
+		}
+	}
+}
+
+// lookup returns the default of an argument for the session of a request, and where it comes from.
+func (d *toolDefaults) lookup(ctx context.Context, argument string) (string, string) {
+	return d.lookupSession(sessionID(ctx), argument)
+}
+
+// lookupSession is lookup for a session id, e.g. the Mcp-Session-Id header of a request.
+func (d *toolDefaults) lookupSession(id, argument string) (string, string) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if session, ok := d.sessions[id]; ok {
+		session.lastUsed = time.Now()
+		if value := session.values[argument]; value != "" {
+			return value, "session"
+		}
+	}
+	if value := d.server[argument]; value != "" {
+		return value, "server"
+	}
+	return "", ""
+}
+
+// get returns the default of an argument for the session of a request.
+func (d *toolDefaults) get(ctx context.Context, argument string) string {
+	value, _ := d.lookup(ctx, argument)
+	return value
+}
+
+// getSession returns the default of an argument for a session id.
+func (d *toolDefaults) getSession(id, argument string) string {
+	value, _ := d.lookupSession(id, argument)
+	return value
+}
+
+// list returns the defaults of the arguments for the session of a request.
+func (d *toolDefaults) list(ctx context.Context) []ArgumentDefault {
+	list := []ArgumentDefault{}
+	for _, argument := range defaultArguments {
+		if value, source := d.lookup(ctx, argument); value != "" {
+			list = append(list, ArgumentDefault{Argument: argument, Value: value, Source: source})
+		}
+	}
+	return list
+}
+
+// set sets the defaults of a session, an empty value unsets a default.
+// The defaults of the sessions unused for sessionDefaultsExpiration are dropped.
+func (d *toolDefaults) set(id string, values map[string]string) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	for other, session := range d.sessions {
+		if time.Since(session.lastUsed) > sessionDefaultsExpiration {
+			delete(d.sessions, other)
+		}
+	}
+	session, ok := d.sessions[id]
+	if !ok {
+		session = &sessionDefaults{values: map[string]string{}}
+		d.sessions[id] = session
+	}
+	session.lastUsed = time.Now()
+	for argument, value := range values {
+		if value == "" {
+			delete(session.values, argument)
+		} else {
+			session.values[argument] = value
+		}
+	}
+}
+
+// forgetOnDelete drops the defaults of the sessions terminated by their client (DELETE of the endpoint).
+func (d *toolDefaults) forgetOnDelete(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r)
+		if r.Method == http.MethodDelete {
+			d.mutex.Lock()
+			delete(d.sessions, r.Header.Get(server.HeaderKeySessionID))
+			d.mutex.Unlock()
+		}
+	})
+}
+
+// middleware fills the omitted arguments of a tool call with their defaults.
+func (d *toolDefaults) middleware(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		if arguments := d.arguments[request.Params.Name]; len(arguments) > 0 {
+			args := maps.Clone(request.GetArguments())
+			if args == nil {
+				args = map[string]any{}
+			}
+			for _, argument := range arguments {
+				if value, _ := args[argument].(string); value != "" {
+					continue
+				}
+				if value := d.get(ctx, argument); value != "" {
+					args[argument] = value
+				}
+			}
+			request.Params.Arguments = args
+		}
+		return next(ctx, request)
+	}
+}
+
+// defaultsText renders the defaults of the arguments, one per line.
+func defaultsText(defaults []ArgumentDefault) string {
+	var text strings.Builder
+	for _, argumentDefault := range defaults {
+		fmt.Fprintf(&text, "- %s: %s (%s)\n", argumentDefault.Argument, argumentDefault.Value, argumentDefault.Source)
+	}
+	return text.String()
+}
+
+// asyncOption declares the async argument of the workspace operations (see runOperation).
+func asyncOption() mcp.ToolOption {
+	return mcp.WithBoolean("async",
+		mcp.Description("Run the operation in the background: the tool returns a job at once, follow it with get_job_status and get_job_log. Use it when the operation may outlast the timeout of the client. Default: false."),
+	)
+}
+
+// onBusyOption declares the on_busy argument of the workspace operations (see onBusy).
+func onBusyOption() mcp.ToolOption {
+	return mcp.WithString("on_busy",
+		mcp.Description("What to do when another operation runs on the workspace: fail at once with a busy error, or wait for it to finish. Default: fail, or wait when the operation runs in the background (async)."),
+		mcp.Enum(string(workspace.OnBusyFail), string(workspace.OnBusyWait)),
+	)
+}
+
+// templateEnum restricts a template argument to the templates available, if any.
+func templateEnum(templates []string) mcp.PropertyOption {
+	if len(templates) == 0 {
+		return func(map[string]any) {}
+	}
+	return mcp.Enum(templates...)
+}
+
+// numberArgument returns a number argument as a string, as the workspace options hold it.
+// A string is accepted too, as sent by the former clients.
+func numberArgument(args map[string]any, name string) string {
+	switch value := args[name].(type) {
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	case string:
+		return value
+	default:
+		return ""
+	}
+}
+
+// stringMapArgument returns an object argument whose values are strings, e.g. build_args.
+// The numbers and booleans are accepted too: a version such as 1.25 may be sent as a number.
+func stringMapArgument(args map[string]any, name string) map[string]string {
+	object, _ := args[name].(map[string]any)
+	if len(object) == 0 {
+		return nil
+	}
+	values := make(map[string]string, len(object))
+	for key, value := range object {
+		switch value := value.(type) {
+		case string:
+			values[key] = value
+		case float64:
+			values[key] = strconv.FormatFloat(value, 'f', -1, 64)
+		case bool:
+			values[key] = strconv.FormatBool(value)
+		case nil:
+			values[key] = ""
+		default:
+			values[key] = fmt.Sprint(value)
+		}
+	}
+	return values
+}
+
+// onBusy returns what a workspace operation does when another one runs on the workspace:
+// the on_busy argument, by default fail for a tool call and wait for a background job.
+func onBusy(request mcp.CallToolRequest) workspace.OnBusy {
+	args := request.GetArguments()
+	if value, _ := args["on_busy"].(string); value != "" {
+		return workspace.OnBusy(value)
+	}
+	if async, _ := args["async"].(bool); async {
+		return workspace.OnBusyWait
+	}
+	return workspace.OnBusyFail
+}
+
+// workspaceToolResult converts the result of a workspace operation into a tool result.
+// A failed operation is returned as a tool error with the steps that ran.
+func workspaceToolResult(action string, result *workspace.Result, err error) *mcp.CallToolResult {
+	if errors.Is(err, workspace.ErrCancelled) {
+		log.Printf("Workspace %s: %s cancelled: %v", result.Workspace, action, err)
+		return mcp.NewToolResultError(fmt.Sprintf("Workspace %s: %s cancelled: %v\n\n%s", result.Workspace, action, err, result))
+	}
+	if err != nil {
+		slog.Error(fmt.Sprintf("Failed to %s workspace %s: %v", action, result.Workspace, err))
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to %s workspace %s: %v\n\n%s", action, result.Workspace, err, result))
+	}
+	log.Printf("Workspace %s: %s successful", result.Workspace, action)
+	return mcp.NewToolResultText(fmt.Sprintf("Workspace %s: %s successful!\n\n%s", result.Workspace, action, result))
+}
+
+// purgeToolResult converts the result of a purge of the trash into a tool result.
+func purgeToolResult(result *workspace.Result, err error) *mcp.CallToolResult {
+	if err != nil {
+		slog.Error(fmt.Sprintf("Failed to purge the trash: %v", err))
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to purge the trash: %v\n\n%s", err, result))
+	}
+	if len(result.Steps) == 0 {
+		return mcp.NewToolResultText("Nothing to purge.")
+	}
+	return mcp.NewToolResultText(fmt.Sprintf("Trash purged!\n\n%s", result))
+}
+
+// trashedWorkspace returns the workspace of an entry of the trash and its projects directory,
+// which name the job of its restore or purge. An unknown entry is named by its id: the operation reports it.
+func trashedWorkspace(engine *workspace.Engine, trashID string) (workspaceName, projectsDirectory string) {
+	entries, err := engine.Trash("")
+	if err != nil {
+		return trashID, ""
+	}
+	if i := slices.IndexFunc(entries, func(entry workspace.TrashEntry) bool { return entry.ID == trashID }); i >= 0 {
+		return entries[i].WorkspaceName, entries[i].ProjectsDirectory
+	}
+	return trashID, ""
+}
+
+// validationToolResult converts the error of the validation of the arguments of a workspace operation
+// into a tool error. The invalid arguments are listed in the text, and in the structured content
+// for the clients showing them next to their fields: {"errors": [{"field": ..., "message": ...}]}.
+// The workspace tools declare no output schema the structured content would have to match.
+func validationToolResult(action, workspaceName string, err error) *mcp.CallToolResult {
+	result := argumentsToolResult(fmt.Sprintf("%s workspace %s", action, workspaceName), err)
+	var validationErr *workspace.ValidationError
+	if errors.As(err, &validationErr) {
+		result.StructuredContent = map[string]any{"errors": validationErr.Fields}
+	}
+	return result
+}
+
+// argumentsToolResult is validationToolResult for the tools which do not run on a workspace,
+// operation being what failed, e.g. "add known host gitlab.example.com". The invalid arguments
+// are only listed in the text: the structured content of these tools follows their output schema.
+func argumentsToolResult(operation string, err error) *mcp.CallToolResult {
+	var validationErr *workspace.ValidationError
+	if !errors.As(err, &validationErr) {
+		slog.Error(fmt.Sprintf("Failed to check the arguments to %s: %v", operation, err))
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to %s: %v", operation, err))
+	}
+	slog.Warn(fmt.Sprintf("Invalid arguments to %s: %v", operation, err))
+	var text strings.Builder
+	fmt.Fprintf(&text, "Failed to %s, invalid arguments:\n", operation)
+	for _, field := range validationErr.Fields {
+		fmt.Fprintf(&text, "- %s: %s\n", field.Field, field.Message)
+	}
+	return mcp.NewToolResultError(text.String())
+}
+
+// resourceArgument returns a variable of the URI of a resource template.
+func resourceArgument(request mcp.ReadResourceRequest, name string) string {
+	switch value := request.Params.Arguments[name].(type) {
+	case string:
+		return value
+	case []string:
+		return strings.Join(value, ",")
+	default:
+		return ""
+	}
+}
+
+// textResource returns the content of a text resource.
+func textResource(uri, mimeType string, content []byte) []mcp.ResourceContents {
+	return []mcp.ResourceContents{
+		mcp.TextResourceContents{URI: uri, MIMEType: mimeType, Text: string(content)},
+	}
+}
+
+// jsonResource returns a value as the content of a JSON resource.
+func jsonResource(uri string, value any) ([]mcp.ResourceContents, error) {
+	content, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return textResource(uri, "application/json", content), nil
 }
@@ -1,2 +0,0 @@
-#!/bin/bash
-rm -rf ./${PROJECTS_DIRECTORY}/${WORKSPACE_NAME}
@@ -1,2 +1,2 @@
 #!/bin/bash
-go run main.go
+go run .
@@ -1,6 +0,0 @@
-#!/bin/bash
-
-cd ${PROJECTS_DIRECTORY}/${WORKSPACE_NAME}
-
-docker compose down
-echo "✅ Local workspace stopped successfully."
@@ -0,0 +1,175 @@
+package workspace
+
+import (
+	"bytes"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// declaredBuildArgs returns the build args a Dockerfile declares with their default value,
+// without the ones set by BuildKit.
+func declaredBuildArgs(content []byte) map[string]string {
+	_, args := parseDockerfile(content)
+	for _, arg := range platformArgs {
+		delete(args, arg)
+	}
+	return args
+}
+
+// buildArgs checks build arg overrides against the build args declared by the Dockerfile of a workspace.
+// An empty value is allowed when empty is true: it removes the override.
+func (v *validation) buildArgs(overrides, declared map[string]string, dockerfile string, empty bool) {
+	for _, name := range slices.Sorted(maps.Keys(overrides)) {
+		field := "build_args." + name
+		value := overrides[name]
+		switch {
+		case slices.Contains(platformArgs, name):
+			v.add(field, "is set by BuildKit")
+		case !hasKey(declared, name):
+			if len(declared) == 0 {
+				v.add(field, "is not a build arg: %s declares none", dockerfile)
+				continue
+			}
+			v.add(field, "is not a build arg of %s (declared: %s)", dockerfile, strings.Join(slices.Sorted(maps.Keys(declared)), ", "))
+		case value == "" && !empty:
+			v.add(field, "is required")
+		default:
+			v.text(field, value)
+		}
+	}
+}
+
+// formatBuildArgs returns the build args as NAME=value, sorted by name.
+// The removed overrides (empty values) are NAME=.
+func formatBuildArgs(args map[string]string) string {
+	words := make([]string, 0, len(args))
+	for _, name := range slices.Sorted(maps.Keys(args)) {
+		words = append(words, name+"="+args[name])
+	}
+	return strings.Join(words, " ")
+}
+
+func hasKey(values map[string]string, key string) bool {
+	_, ok := values[key]
+	return ok
+}
+
+// composeBuildArgs returns the build args of the web IDE service of a compose file.
+func composeBuildArgs(path string) (map[string]string, error) {
+	document, err := readComposeFile(path)
+	if err != nil {
+		return nil, err
+	}
+	build, err := composeBuild(path, document)
+	if err != nil {
+		return nil, err
+	}
+	args := map[string]string{}
+	node := mappingValue(build, "args")
+	if node == nil {
+		return args, nil
+	}
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			args[node.Content[i].Value] = node.Content[i+1].Value
+		}
+	case yaml.SequenceNode:
+		// - GO_VERSION=1.24.4
+		for _, item := range node.Content {
+			name, value, _ := strings.Cut(item.Value, "=")
+			args[name] = value
+		}
+	}
+	return args, nil
+}
+
+// setComposeBuildArgs writes the build args of the web IDE service of a compose file,
+// removing them when args is empty. The values are quoted: 1.20 stays a string.
+func setComposeBuildArgs(path string, args map[string]string) error {
+	document, err := readComposeFile(path)
+	if err != nil {
+		return err
+	}
+	build, err := composeBuild(path, document)
+	if err != nil {
+		return err
+	}
+	for i := 0; i+1 < len(build.Content); i += 2 {
+		if build.Content[i].Value == "args" {
+			build.Content = slices.Delete(build.Content, i, i+2)
+			break
+		}
+	}
+	if len(args) > 0 {
+		node := &yaml.Node{Kind: yaml.MappingNode}
+		for _, name := range slices.Sorted(maps.Keys(args)) {
+			node.Content = append(node.Content,
+				&yaml.Node{Kind: yaml.ScalarNode, Value: name},
+				&yaml.Node{Kind: yaml.ScalarNode, Style: yaml.DoubleQuotedStyle, Value: args[name]})
+		}
+		build.Content = append(build.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: "args"}, node)
+	}
+
+	var buffer bytes.Buffer
+	encoder := yaml.NewEncoder(&buffer)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(document); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	if err := encoder.Close(); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return os.WriteFile(path, buffer.Bytes(), 0644)
+}
+
+func readComposeFile(path string) (*yaml.Node, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var document yaml.Node
+	if err := yaml.Unmarshal(data, &document); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &document, nil
+}
+
+// composeBuild returns the build section of the web IDE service of a compose file.
+// A short build section (build: .) is turned into a mapping, which can hold build args.
+func composeBuild(path string, document *yaml.Node) (*yaml.Node, error) {
+	if len(document.Content) == 0 {
+		return nil, fmt.Errorf("%s: empty compose file", path)
+	}
+	service := mappingValue(mappingValue(document.Content[0], "services"), webIDEService)
+	build := mappingValue(service, "build")
+	if build == nil {
+		return nil, fmt.Errorf("%s: the %s service has no build section", path, webIDEService)
+	}
+	if build.Kind == yaml.ScalarNode {
+		context := *build
+		*build = yaml.Node{Kind: yaml.MappingNode, Content: []*yaml.Node{{Kind: yaml.ScalarNode, Value: "context"}, &context}}
+	}
+	if build.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("%s: the build section of the %s service is not a mapping", path, webIDEService)
+	}
+	return build, nil
+}
+
+// mappingValue returns the value of key in a mapping node, nil when there is none.
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
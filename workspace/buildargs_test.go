@@ -0,0 +1,130 @@
+package workspace
+
+import (
+	"maps"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestComposeBuildArgs(t *testing.T) {
+	tests := []struct {
+		name    string
+		compose string
+		want    map[string]string
+	}{
+		{
+			name:    "short build section",
+			compose: "services:\n  web-ide:\n    build: .\n",
+			want:    map[string]string{},
+		},
+		{
+			name:    "args mapping",
+			compose: "services:\n  web-ide:\n    build:\n      context: .\n      args:\n        GO_VERSION: \"1.24.4\"\n        USER_NAME: bob\n",
+			want:    map[string]string{"GO_VERSION": "1.24.4", "USER_NAME": "bob"},
+		},
+		{
+			name:    "args list",
+			compose: "services:\n  web-ide:\n    build:\n      context: .\n      args:\n        - GO_VERSION=1.24.4\n        - EMPTY=\n",
+			want:    map[string]string{"GO_VERSION": "1.24.4", "EMPTY": ""},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "compose.yml")
+			if err := os.WriteFile(path, []byte(test.compose), 0644); err != nil {
+				t.Fatal(err)
+			}
+			args, err := composeBuildArgs(path)
+			if err != nil {
+				t.Fatalf("composeBuildArgs: %v", err)
+			}
+			if !maps.Equal(args, test.want) {
+				t.Errorf("composeBuildArgs = %v, want %v", args, test.want)
+			}
+		})
+	}
+}
+
+func TestComposeBuildArgsErrors(t *testing.T) {
+	for _, compose := range []string{
+		"",
+		"services:\n  web-ide:\n    image: nginx\n",
+		"models:\n  llm:\n    model: ai/qwen3\n",
+		"services:\n  web-ide:\n    build:\n      - .\n",
+		"services: [",
+	} {
+		path := filepath.Join(t.TempDir(), "compose.yml")
+		if err := os.WriteFile(path, []byte(compose), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if args, err := composeBuildArgs(path); err == nil {
+			t.Errorf("composeBuildArgs(%q) = %v, want an error", compose, args)
+		}
+	}
+}
+
+func TestSetComposeBuildArgs(t *testing.T) {
+	tests := []struct {
+		name     string
+		compose  string
+		args     map[string]string
+		contains []string // lines of the written compose file
+		missing  []string
+	}{
+		{
+			name:     "short build section turned into a mapping",
+			compose:  "services:\n  web-ide:\n    build: .\n    ports:\n      - \"8100:3000\"\n",
+			args:     map[string]string{"GO_VERSION": "1.20"},
+			contains: []string{"    build:", "      context: .", "      args:", `        GO_VERSION: "1.20"`, `      - "8100:3000"`},
+		},
+		{
+			name:     "args replaced and sorted",
+			compose:  "services:\n  web-ide:\n    build:\n      context: .\n      args:\n        - OLD=1\n",
+			args:     map[string]string{"TINYGO_VERSION": "0.38.0", "GO_VERSION": "1.25.0"},
+			contains: []string{`        GO_VERSION: "1.25.0"` + "\n" + `        TINYGO_VERSION: "0.38.0"`},
+			missing:  []string{"OLD"},
+		},
+		{
+			name:     "args removed",
+			compose:  "services:\n  web-ide:\n    build:\n      context: .\n      args:\n        GO_VERSION: \"1.25.0\"\n",
+			args:     map[string]string{},
+			contains: []string{"      context: ."},
+			missing:  []string{"args", "GO_VERSION"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "compose.yml")
+			if err := os.WriteFile(path, []byte(test.compose), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := setComposeBuildArgs(path, test.args); err != nil {
+				t.Fatalf("setComposeBuildArgs: %v", err)
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, text := range test.contains {
+				if !strings.Contains(string(data), text) {
+					t.Errorf("compose file without %q:\n%s", text, data)
+				}
+			}
+			for _, text := range test.missing {
+				if strings.Contains(string(data), text) {
+					t.Errorf("compose file with %q:\n%s", text, data)
+				}
+			}
+			// the written build args are read back
+			args, err := composeBuildArgs(path)
+			if err != nil {
+				t.Fatalf("composeBuildArgs: %v", err)
+			}
+			if !maps.Equal(args, test.args) {
+				t.Errorf("composeBuildArgs = %v, want %v", args, test.args)
+			}
+		})
+	}
+}
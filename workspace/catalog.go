@@ -0,0 +1,182 @@
+package workspace
+
+import (
+	"bufio"
+	"bytes"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// The labels of a Dockerfile template describing it:
+//
+//	LABEL codex.name="Go" \
+//	      codex.language="go" \
+//	      codex.description="Go toolchain" \
+//	      codex.tags="go,golang" \
+//	      codex.docker-in-docker="false"
+const (
+	LabelName           = "codex.name"
+	LabelLanguage       = "codex.language"
+	LabelDescription    = "codex.description"
+	LabelTags           = "codex.tags"
+	LabelDockerInDocker = "codex.docker-in-docker"
+)
+
+// TemplateInfo describes a Dockerfile template, from its LABEL and ARG instructions.
+type TemplateInfo struct {
+	Name           string            `json:"name"`         // file name, e.g. golang.Dockerfile
+	DisplayName    string            `json:"display_name"` // codex.name, the file name without extension by default
+	Language       string            `json:"language,omitempty"`
+	Description    string            `json:"description,omitempty"`
+	ToolVersions   map[string]string `json:"tool_versions,omitempty"` // from the <TOOL>_VERSION and <TOOL>_MAJOR build args
+	BuildArgs      map[string]string `json:"build_args,omitempty"`    // the ARGs with their default value
+	Tags           []string          `json:"tags,omitempty"`
+	DockerInDocker bool              `json:"docker_in_docker"`
+}
+
+// platformArgs are the build args set by BuildKit, not by the template.
+var platformArgs = []string{"BUILDPLATFORM", "BUILDOS", "BUILDARCH", "BUILDVARIANT", "TARGETPLATFORM", "TARGETOS", "TARGETARCH", "TARGETVARIANT"}
+
+// toolVersionArg matches the build args holding the version of a tool: GO_VERSION, NODE_MAJOR.
+var toolVersionArg = regexp.MustCompile(`^([A-Z0-9]+)_(VERSION|MAJOR)$`)
+
+// Catalog returns the description of the Dockerfile templates.
+func (e *Engine) Catalog() ([]TemplateInfo, error) {
+	dockerfiles, err := e.Dockerfiles()
+	if err != nil {
+		return nil, err
+	}
+	catalog := make([]TemplateInfo, 0, len(dockerfiles))
+	for _, name := range dockerfiles {
+		info, err := e.DescribeTemplate(name)
+		if err != nil {
+			return nil, err
+		}
+		catalog = append(catalog, *info)
+	}
+	return catalog, nil
+}
+
+// DescribeTemplate returns the description of a Dockerfile template.
+func (e *Engine) DescribeTemplate(name string) (*TemplateInfo, error) {
+	content, err := e.ReadTemplate(name)
+	if err != nil {
+		return nil, err
+	}
+	labels, args := parseDockerfile(content)
+	info := &TemplateInfo{
+		Name:        name,
+		DisplayName: labels[LabelName],
+		Language:    labels[LabelLanguage],
+		Description: labels[LabelDescription],
+		BuildArgs:   map[string]string{},
+	}
+	if info.DisplayName == "" {
+		info.DisplayName = strings.TrimSuffix(name, ".Dockerfile")
+	}
+	for tag := range strings.SplitSeq(labels[LabelTags], ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			info.Tags = append(info.Tags, tag)
+		}
+	}
+	info.DockerInDocker, _ = strconv.ParseBool(labels[LabelDockerInDocker])
+	for arg, value := range args {
+		if slices.Contains(platformArgs, arg) {
+			continue
+		}
+		info.BuildArgs[arg] = value
+		if match := toolVersionArg.FindStringSubmatch(arg); match != nil {
+			if info.ToolVersions == nil {
+				info.ToolVersions = map[string]string{}
+			}
+			info.ToolVersions[strings.ToLower(match[1])] = value
+		}
+	}
+	return info, nil
+}
+
+// parseDockerfile returns the labels and the build args (with their default value) of a Dockerfile.
+// The continuation lines are joined and the heredocs (RUN <<EOF) skipped.
+func parseDockerfile(content []byte) (map[string]string, map[string]string) {
+	labels, args := map[string]string{}, map[string]string{}
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	heredoc := ""
+	var instruction strings.Builder
+	for scanner.Scan() {
+		line := scanner.Text()
+		if heredoc != "" {
+			if strings.TrimSpace(line) == heredoc {
+				heredoc = ""
+			}
+			continue
+		}
+		trimmed := strings.TrimSpace(line)
+		if instruction.Len() == 0 && (trimmed == "" || strings.HasPrefix(trimmed, "#")) {
+			continue
+		}
+		if continued, ok := strings.CutSuffix(trimmed, `\`); ok {
+			instruction.WriteString(continued + " ")
+			continue
+		}
+		instruction.WriteString(trimmed)
+		keyword, arguments, _ := strings.Cut(instruction.String(), " ")
+		instruction.Reset()
+		switch strings.ToUpper(keyword) {
+		case "RUN":
+			if _, delimiter, found := strings.Cut(arguments, "<<"); found && len(strings.Fields(delimiter)) > 0 {
+				heredoc = strings.Trim(strings.TrimPrefix(strings.Fields(delimiter)[0], "-"), `"'`)
+			}
+		case "LABEL":
+			for _, word := range splitWords(arguments) {
+				if key, value, ok := strings.Cut(word, "="); ok {
+					labels[key] = value
+				}
+			}
+		case "ARG":
+			for _, word := range splitWords(arguments) {
+				name, value, _ := strings.Cut(word, "=")
+				args[name] = value
+			}
+		}
+	}
+	return labels, args
+}
+
+// splitWords splits the arguments of an instruction on the spaces,
+// the quoted strings ("a b" or 'a b') being kept together without their quotes.
+func splitWords(arguments string) []string {
+	var words []string
+	var word strings.Builder
+	inWord := false
+	var quote rune
+	escaped := false
+	for _, char := range arguments {
+		switch {
+		case escaped:
+			word.WriteRune(char)
+			escaped = false
+		case char == '\\' && quote != '\'':
+			escaped = true
+		case quote != 0 && char == quote:
+			quote = 0
+		case quote == 0 && (char == '"' || char == '\''):
+			quote = char
+			inWord = true
+		case quote == 0 && (char == ' ' || char == '\t'):
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(char)
+			inWord = true
+		}
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words
+}
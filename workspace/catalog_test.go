@@ -0,0 +1,123 @@
+package workspace
+
+import (
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestParseDockerfile(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		labels  map[string]string
+		args    map[string]string
+	}{
+		{
+			name: "labels and args",
+			content: `FROM gitpod/openvscode-server:latest
+LABEL maintainer="@k33g_org"
+ARG TARGETARCH
+ARG GO_VERSION=1.24.4
+`,
+			labels: map[string]string{"maintainer": "@k33g_org"},
+			args:   map[string]string{"TARGETARCH": "", "GO_VERSION": "1.24.4"},
+		},
+		{
+			name: "continuation lines and comments",
+			content: `# the metadata of the catalog
+label codex.name="Go" \
+      codex.description="Go toolchain, with the module cache" \
+      codex.tags="go,golang"
+ARG NODE_MAJOR=22 \
+    NPM_VERSION=10
+`,
+			labels: map[string]string{"codex.name": "Go", "codex.description": "Go toolchain, with the module cache", "codex.tags": "go,golang"},
+			args:   map[string]string{"NODE_MAJOR": "22", "NPM_VERSION": "10"},
+		},
+		{
+			name: "heredocs skipped",
+			content: `RUN <<EOF
+ARG NOT_AN_ARG=1
+LABEL not="a label"
+EOF
+RUN <<-"SCRIPT" bash
+ARG STILL_NOT=1
+SCRIPT
+ARG PYTHON_VERSION=3.12
+`,
+			labels: map[string]string{},
+			args:   map[string]string{"PYTHON_VERSION": "3.12"},
+		},
+		{
+			name:    "empty",
+			content: "",
+			labels:  map[string]string{},
+			args:    map[string]string{},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			labels, args := parseDockerfile([]byte(test.content))
+			if !maps.Equal(labels, test.labels) {
+				t.Errorf("labels = %v, want %v", labels, test.labels)
+			}
+			if !maps.Equal(args, test.args) {
+				t.Errorf("args = %v, want %v", args, test.args)
+			}
+		})
+	}
+}
+
+func TestSplitWords(t *testing.T) {
+	tests := []struct {
+		arguments string
+		want      []string
+	}{
+		{arguments: "", want: nil},
+		{arguments: "a b\tc", want: []string{"a", "b", "c"}},
+		{arguments: "  a   b  ", want: []string{"a", "b"}},
+		{arguments: `name="a b" other='c d'`, want: []string{"name=a b", "other=c d"}},
+		{arguments: `"" b`, want: []string{"", "b"}},
+		{arguments: `a\ b c`, want: []string{"a b", "c"}},
+		{arguments: `"say \"hi\"" 'it\'`, want: []string{`say "hi"`, `it\`}},
+		{arguments: `name="it's"`, want: []string{"name=it's"}},
+	}
+	for _, test := range tests {
+		if got := splitWords(test.arguments); !slices.Equal(got, test.want) {
+			t.Errorf("splitWords(%q) = %q, want %q", test.arguments, got, test.want)
+		}
+	}
+}
+
+func TestDescribeTemplate(t *testing.T) {
+	templates := t.TempDir()
+	dockerfile := `FROM gitpod/openvscode-server:latest
+LABEL codex.language="go" codex.tags="go, golang," codex.docker-in-docker="true"
+ARG TARGETARCH
+ARG GO_VERSION=1.24.4
+ARG NODE_MAJOR=22
+ARG USERNAME=openvscode-server
+`
+	if err := os.WriteFile(filepath.Join(templates, "golang.Dockerfile"), []byte(dockerfile), 0644); err != nil {
+		t.Fatal(err)
+	}
+	info, err := NewEngine(WithTemplatesDirectory(templates)).DescribeTemplate("golang.Dockerfile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Name != "golang.Dockerfile" || info.DisplayName != "golang" || info.Language != "go" || !info.DockerInDocker {
+		t.Errorf("DescribeTemplate = %+v", info)
+	}
+	if want := []string{"go", "golang"}; !slices.Equal(info.Tags, want) {
+		t.Errorf("Tags = %q, want %q", info.Tags, want)
+	}
+	if want := map[string]string{"GO_VERSION": "1.24.4", "NODE_MAJOR": "22", "USERNAME": "openvscode-server"}; !maps.Equal(info.BuildArgs, want) {
+		t.Errorf("BuildArgs = %v, want %v", info.BuildArgs, want)
+	}
+	if want := map[string]string{"go": "1.24.4", "node": "22"}; !maps.Equal(info.ToolVersions, want) {
+		t.Errorf("ToolVersions = %v, want %v", info.ToolVersions, want)
+	}
+}
@@ -0,0 +1,393 @@
+package workspace
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	privateKeyName = "git_repository_key"
+	publicKeyName  = "git_repository_key.pub"
+	knownHostsName = "known_hosts"
+)
+
+const bashrc = `sudo chmod 666 /var/run/docker.sock
+
+parse_git_branch() {
+    git branch 2> /dev/null | sed -e '/^[^*]/d' -e 's/* \(.*\)/(\1)/'
+}
+
+# Prompt avec couleurs
+export PS1='\[\033[01;32m\]\u@\h\[\033[00m\]:\[\033[01;34m\]\w\[\033[01;31m\]$(parse_git_branch)\[\033[00m\]\$ '
+`
+
+// The defaults of the optional parameters of the initializer_workspace tool.
+const (
+	DefaultGitHost             = "github.com"
+	DefaultComposeFileName     = "compose.yml"
+	DefaultOffloadOverrideName = "compose.offload.yml"
+)
+
+// CreateOptions are the parameters of the initializer_workspace tool.
+// The empty optional parameters get their default (see applyDefaults).
+type CreateOptions struct {
+	KeyName             string  // SSH key copied with the key mode
+	SSHAuth             SSHAuth // key (default), agent or deploy_key
+	GitUserEmail        string
+	GitUserName         string
+	GitHost             string // github.com by default, not used with a clone URL
+	Repository          string // path on GitHost, scp-like address or clone URL (see ParseRemote)
+	GitToken            string // token for HTTPS remotes, optional
+	WorkspaceName       string
+	ProjectsDirectory   string
+	DockerfileName      string
+	ComposeFileName     string            // compose.yml by default
+	OffloadOverrideName string            // compose.offload.yml by default
+	HTTPPort            string            // allocated from the port range when empty
+	BuildArgs           map[string]string // overrides of the ARGs of the Dockerfile, e.g. GO_VERSION
+	OnBusy              OnBusy            // when another operation runs on the workspace (fail by default)
+}
+
+// applyDefaults sets the empty optional parameters to their default.
+func (o *CreateOptions) applyDefaults() {
+	if o.SSHAuth == "" {
+		o.SSHAuth = SSHAuthKey
+	}
+	if o.GitHost == "" {
+		o.GitHost = DefaultGitHost
+	}
+	if o.ComposeFileName == "" {
+		o.ComposeFileName = DefaultComposeFileName
+	}
+	if o.OffloadOverrideName == "" {
+		o.OffloadOverrideName = DefaultOffloadOverrideName
+	}
+}
+
+// Create initializes a workspace:
+//
+//	<projects_directory>/<workspace_name>/
+//	├── Dockerfile, compose.yml, compose.offload.yml, .env
+//	├── keys/       mounted as ~/.ssh in the web IDE
+//	└── workspace/  mounted as /home/workspace, contains the cloned repository
+//
+// With the deploy_key mode, the repository is cloned at the first start,
+// once the generated public key (Result.PublicKey) is added to the repository.
+func (e *Engine) Create(ctx context.Context, options CreateOptions) (*Result, error) {
+	result, ctx := newResult(ctx, "create", options.WorkspaceName, 6)
+	options.applyDefaults()
+	dir := e.Dir(options.ProjectsDirectory, options.WorkspaceName)
+	workspaceDir := filepath.Join(dir, "workspace")
+
+	var remote *Remote
+	var knownHosts string
+	unlock := func() {}
+	defer func() { unlock() }()
+	err := result.do("check_workspace", func(step *Step) error {
+		if err := e.ValidateCreate(options); err != nil {
+			return err
+		}
+		release, err := e.lock(ctx, options.ProjectsDirectory, options.WorkspaceName, "create", options.OnBusy)
+		if err != nil {
+			return err
+		}
+		unlock = release
+		if _, err := os.Stat(dir); err == nil {
+			return fmt.Errorf("%w: %s", ErrWorkspaceExists, dir)
+		}
+		remote, err = ParseRemote(options.GitHost, options.Repository)
+		if err != nil {
+			return err
+		}
+		switch {
+		case remote.Protocol == ProtocolHTTPS && options.SSHAuth != SSHAuthKey:
+			return fmt.Errorf("%w: %s needs an SSH repository, %s is cloned with HTTPS", ErrInvalidSSHAuth, options.SSHAuth, remote.CloneURL())
+		case remote.Protocol == ProtocolSSH && options.SSHAuth == SSHAuthKey && options.KeyName == "":
+			return fmt.Errorf("%w: key_name is required to clone %s", ErrKeyNotFound, remote.CloneURL())
+		case options.SSHAuth == SSHAuthAgent:
+			if err := e.checkSSHAgent(); err != nil {
+				return err
+			}
+		}
+		if remote.Protocol == ProtocolSSH {
+			knownHosts, err = e.hostKnownHosts(ctx, remote)
+			if err != nil {
+				return err
+			}
+		}
+		// the port is reserved until the workspace is removed
+		if options.HTTPPort, err = e.reservePort(options.ProjectsDirectory, options.WorkspaceName, options.HTTPPort); err != nil {
+			return err
+		}
+		step.Message = fmt.Sprintf("Workspace name and templates checked, HTTP port %s reserved", options.HTTPPort)
+		return nil
+	})
+	if err != nil {
+		return result, err
+	}
+
+	manifest := &Manifest{
+		WorkspaceName:       options.WorkspaceName,
+		ProjectsDirectory:   options.ProjectsDirectory,
+		Repository:          options.Repository,
+		CloneURL:            remote.CloneURL(),
+		GitHost:             remote.Host,
+		GitUserName:         options.GitUserName,
+		GitUserEmail:        options.GitUserEmail,
+		KeyName:             options.KeyName,
+		SSHAuth:             options.SSHAuth,
+		DockerfileName:      options.DockerfileName,
+		ComposeFileName:     options.ComposeFileName,
+		OffloadOverrideName: options.OffloadOverrideName,
+		HTTPPort:            options.HTTPPort,
+		BuildArgs:           options.BuildArgs,
+		State:               StateInitializing,
+		CreatedAt:           time.Now().UTC(),
+	}
+	created := false
+	err = result.do("initialize_workspace", func(step *Step) error {
+		if err := os.MkdirAll(options.ProjectsDirectory, 0755); err != nil {
+			return err
+		}
+		// Mkdir fails when the directory exists: of two concurrent creations
+		// of the same workspace, only one goes further
+		if err := os.Mkdir(dir, 0755); err != nil {
+			if errors.Is(err, fs.ErrExist) {
+				return fmt.Errorf("%w: %s", ErrWorkspaceExists, dir)
+			}
+			return err
+		}
+		created = true
+		if err := os.Mkdir(workspaceDir, 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(workspaceDir, ".bashrc"), []byte(bashrc), 0644); err != nil {
+			return err
+		}
+		// from now on, the manifest tracks the state of the workspace
+		if err := e.SaveManifest(manifest); err != nil {
+			return err
+		}
+		step.Message = "Workspace initialized with .bashrc"
+		return nil
+	})
+	if err != nil {
+		// the port of a workspace which could not be created is free again
+		if !created {
+			if err := e.releasePort(options.ProjectsDirectory, options.WorkspaceName); err != nil {
+				slog.Error(fmt.Sprintf("Failed to release the port of %s: %v", options.WorkspaceName, err))
+			}
+		}
+		return result, err
+	}
+
+	err = e.populate(ctx, options, remote, knownHosts, result)
+	if errors.Is(err, ErrCancelled) {
+		// the half created workspace is deleted, it can be created again
+		result.rollback("rollback", func(step *Step) error {
+			step.Message = fmt.Sprintf("Directory %s deleted, HTTP port %s released", dir, options.HTTPPort)
+			if err := os.RemoveAll(dir); err != nil {
+				return err
+			}
+			return e.releasePort(options.ProjectsDirectory, options.WorkspaceName)
+		})
+		return result, err
+	}
+	if err != nil {
+		e.removeSecrets(options.ProjectsDirectory, options.WorkspaceName)
+	}
+	manifest.ProjectName = e.ProjectName(options.ProjectsDirectory, options.WorkspaceName)
+	return result, e.finish(manifest, "create", StateReady, err)
+}
+
+// populate runs the steps of Create once the workspace directory and its manifest exist.
+// knownHosts holds the trusted keys of the git host (SSH remotes only).
+func (e *Engine) populate(ctx context.Context, options CreateOptions, remote *Remote, knownHosts string, result *Result) error {
+	dir := e.Dir(options.ProjectsDirectory, options.WorkspaceName)
+	workspaceDir := filepath.Join(dir, "workspace")
+	keysDir := filepath.Join(dir, "keys")
+
+	err := result.do("configure_git", func(step *Step) error {
+		gitconfig := strings.Join([]string{
+			"[user]",
+			"    email = " + options.GitUserEmail,
+			"    name = " + options.GitUserName,
+			"[safe]",
+			"[http]",
+			"    postBuffer = 524288000",
+			"    lowSpeedLimit = 1000",
+			"    lowSpeedTime = 300",
+			"[init]",
+			"    defaultBranch = main",
+			"",
+		}, "\n")
+		if remote.Protocol == ProtocolHTTPS && options.GitToken != "" {
+			// the web IDE pushes with the token (HOME is /home/workspace)
+			gitconfig += "[credential]\n    helper = store\n"
+			if err := writeSecret(filepath.Join(workspaceDir, ".git-credentials"), []byte(remote.credentialsLine(options.GitToken))); err != nil {
+				return err
+			}
+		}
+		if err := os.WriteFile(filepath.Join(workspaceDir, ".gitconfig"), []byte(gitconfig), 0644); err != nil {
+			return err
+		}
+		step.Message = "Git user configured"
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	err = result.do("install_ssh_key", func(step *Step) error {
+		if err := os.MkdirAll(keysDir, 0700); err != nil {
+			return err
+		}
+		// keys/ is mounted on ~/.ssh in the web IDE
+		sshConfig := ""
+		if remote.Protocol == ProtocolSSH {
+			sshConfig = remote.sshConfig(options.SSHAuth)
+			// no StrictHostKeyChecking no: only the trusted keys of the git host are accepted
+			if err := os.WriteFile(filepath.Join(keysDir, knownHostsName), []byte(knownHosts), 0644); err != nil {
+				return err
+			}
+		}
+
+		var privateKey, publicKey []byte
+		switch options.SSHAuth {
+		case SSHAuthAgent:
+			step.Message = "SSH agent of the host forwarded to the web IDE, no key copied"
+			return writeSecret(filepath.Join(keysDir, "config"), []byte(sshConfig))
+		case SSHAuthDeployKey:
+			var err error
+			privateKey, publicKey, err = generateDeployKey("compose-codex-" + options.WorkspaceName)
+			if err != nil {
+				return err
+			}
+			result.PublicKey = string(publicKey)
+			step.Message = "Deploy key generated for the workspace"
+		default:
+			if options.KeyName == "" {
+				step.Message = "No SSH key to install (HTTPS remote)"
+				return nil
+			}
+			// the key is never encoded nor written outside of the workspace
+			var err error
+			privateKey, publicKey, err = e.readKeyPair(options.KeyName)
+			if err != nil {
+				return err
+			}
+			step.Message = fmt.Sprintf("SSH key %s installed", options.KeyName)
+		}
+		defer clear(privateKey)
+
+		if err := writeSecret(filepath.Join(keysDir, "config"), []byte(sshConfig)); err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(keysDir, publicKeyName), publicKey, 0644); err != nil {
+			return err
+		}
+		return writeSecret(filepath.Join(keysDir, privateKeyName), privateKey)
+	})
+	if err != nil {
+		return err
+	}
+
+	if options.SSHAuth == SSHAuthDeployKey {
+		err = result.do("clone_repository", func(step *Step) error {
+			step.Message = "Clone postponed to the first start: add the deploy key to the repository first"
+			return nil
+		})
+	} else {
+		err = e.clone(ctx, result, dir, remote, options.SSHAuth, options.GitToken)
+	}
+	if err != nil {
+		return err
+	}
+
+	err = result.do("copy_templates", func(step *Step) error {
+		copies := map[string]string{
+			options.DockerfileName:      "Dockerfile",
+			options.ComposeFileName:     options.ComposeFileName,
+			options.OffloadOverrideName: options.OffloadOverrideName,
+		}
+		for source, target := range copies {
+			data, err := e.readTemplate(source)
+			if err != nil {
+				return err
+			}
+			if err := os.WriteFile(filepath.Join(dir, target), data, 0644); err != nil {
+				return err
+			}
+		}
+		if len(options.BuildArgs) > 0 {
+			if err := setComposeBuildArgs(filepath.Join(dir, options.ComposeFileName), options.BuildArgs); err != nil {
+				return err
+			}
+		}
+		if err := os.WriteFile(filepath.Join(dir, ".env"), []byte("HTTP_PORT="+options.HTTPPort+"\n"), 0644); err != nil {
+			return err
+		}
+		if options.SSHAuth == SSHAuthAgent {
+			if err := os.WriteFile(filepath.Join(dir, sshAgentOverrideName), []byte(e.sshAgentOverride()), 0644); err != nil {
+				return err
+			}
+		}
+		step.Message = "Dockerfile and compose files copied to workspace"
+		if len(options.BuildArgs) > 0 {
+			step.Message += ", with the build args " + formatBuildArgs(options.BuildArgs)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// clone runs the clone_repository step: git clone of the remote into <workspace>/workspace.
+// A cancelled clone leaves no partial repository.
+func (e *Engine) clone(ctx context.Context, result *Result, dir string, remote *Remote, auth SSHAuth, gitToken string) error {
+	err := result.do("clone_repository", func(step *Step) error {
+		var env []string
+		switch {
+		case remote.Protocol == ProtocolSSH:
+			command, err := sshCommand(auth, filepath.Join(dir, "keys"))
+			if err != nil {
+				return err
+			}
+			env = []string{"GIT_SSH_COMMAND=" + command}
+		case gitToken != "":
+			env = remote.tokenEnv(gitToken)
+		default:
+			env = []string{"GIT_TERMINAL_PROMPT=0"}
+		}
+		output, err := e.run(ctx, filepath.Join(dir, "workspace"), env, "git", "clone", "--", remote.CloneURL())
+		step.Output = output
+		if err != nil {
+			step.Message = fmt.Sprintf("Failed to clone repository %s", remote.CloneURL())
+			if mismatch := e.hostKeyError(remote, output); mismatch != nil {
+				return mismatch
+			}
+			return err
+		}
+		step.Message = fmt.Sprintf("Project %s cloned into workspace", remote.CloneURL())
+		return nil
+	})
+	if errors.Is(err, ErrCancelled) {
+		if project := e.ProjectName(filepath.Dir(dir), filepath.Base(dir)); project != "" {
+			result.rollback("rollback_clone", func(step *Step) error {
+				step.Message = fmt.Sprintf("Partial clone %s deleted", project)
+				return os.RemoveAll(filepath.Join(dir, "workspace", project))
+			})
+		}
+	}
+	return err
+}
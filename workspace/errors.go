@@ -0,0 +1,54 @@
+package workspace
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	ErrWorkspaceExists   = errors.New("workspace already exists")
+	ErrWorkspaceNotFound = errors.New("workspace not found")
+	ErrKeyNotFound       = errors.New("ssh key not found")
+	ErrTemplateNotFound  = errors.New("template not found")
+	// ErrCancelled is returned when the context of an operation is done:
+	// the client cancelled the tool call or went away, or the timeout of the tool expired.
+	ErrCancelled = errors.New("operation cancelled")
+)
+
+// cancelError returns ErrCancelled with the cause of the cancellation
+// (context.Canceled or context.DeadlineExceeded).
+func cancelError(ctx context.Context) error {
+	return fmt.Errorf("%w: %w", ErrCancelled, context.Cause(ctx))
+}
+
+// StepError reports which step of an operation failed.
+type StepError struct {
+	Step string
+	Err  error
+}
+
+func (e *StepError) Error() string {
+	return fmt.Sprintf("step %s failed: %v", e.Step, e.Err)
+}
+
+func (e *StepError) Unwrap() error {
+	return e.Err
+}
+
+// CommandError is returned when an external command (git, docker) fails.
+// Output holds what the command printed.
+type CommandError struct {
+	Command []string
+	Output  string
+	Err     error
+}
+
+func (e *CommandError) Error() string {
+	return fmt.Sprintf("%s: %v", strings.Join(e.Command, " "), e.Err)
+}
+
+func (e *CommandError) Unwrap() error {
+	return e.Err
+}
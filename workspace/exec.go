@@ -0,0 +1,44 @@
+package workspace
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"time"
+)
+
+// run executes a command in dir and returns its combined output.
+// A failure is returned as a *CommandError. When ctx is done, the command
+// and its children are killed and the error wraps ErrCancelled.
+func (e *Engine) run(ctx context.Context, dir string, env []string, name string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), env...)
+	killProcessTree(cmd)
+	// a child outside of the process group may keep the output open
+	cmd.WaitDelay = 5 * time.Second
+
+	var output []byte
+	var err error
+	if tracker := trackerFrom(ctx); tracker != nil {
+		// the output is reported line by line while the command runs
+		writer := &lineWriter{fn: tracker.line}
+		cmd.Stdout = writer
+		cmd.Stderr = writer
+		err = cmd.Run()
+		output = []byte(writer.String())
+	} else {
+		output, err = cmd.CombinedOutput()
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			err = cancelError(ctx)
+		}
+		return string(output), &CommandError{
+			Command: append([]string{name}, args...),
+			Output:  string(output),
+			Err:     err,
+		}
+	}
+	return string(output), nil
+}
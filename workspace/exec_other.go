@@ -0,0 +1,8 @@
+//go:build !unix
+
+package workspace
+
+import "os/exec"
+
+// killProcessTree keeps the default cancellation of the command: only the command is killed.
+func killProcessTree(cmd *exec.Cmd) {}
@@ -0,0 +1,18 @@
+//go:build unix
+
+package workspace
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// killProcessTree runs the command in its own process group, killed as a whole
+// when the context of the command is done: docker compose and git run helpers
+// (buildx, ssh, git-remote-https) that would survive their parent.
+func killProcessTree(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+}
@@ -0,0 +1,183 @@
+package workspace
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+var ErrFileNotFound = errors.New("file not found")
+
+// BuildLogName is the file of a workspace holding the output of its last build (start_workspace).
+const BuildLogName = "build.log"
+
+// WorkspaceFiles are the files of a workspace readable by the clients, by resource name.
+// compose.yml is the compose file of the workspace, whatever its name (see Manifest.composeFile).
+var WorkspaceFiles = map[string]string{
+	"compose.yml": "compose.yml",
+	"Dockerfile":  "Dockerfile",
+	"manifest":    ManifestFileName,
+	"build-log":   BuildLogName,
+}
+
+// templateSources returns where the templates are read from, by priority:
+// the templates directory, then the default templates.
+func (e *Engine) templateSources() []fs.FS {
+	var sources []fs.FS
+	if e.TemplatesDirectory != "" {
+		sources = append(sources, os.DirFS(e.TemplatesDirectory))
+	}
+	if e.TemplatesFS != nil {
+		sources = append(sources, e.TemplatesFS)
+	}
+	return sources
+}
+
+// Templates returns the names of the templates: the Dockerfiles (*.Dockerfile) and compose files (*.yml),
+// of the templates directory and of the default templates. A missing templates directory has no template.
+// The names starting with "_" are bases of the other templates (e.g. _.Dockerfile), not templates.
+func (e *Engine) Templates() ([]string, error) {
+	templates := []string{}
+	for _, source := range e.templateSources() {
+		for _, pattern := range []string{"*.Dockerfile", "*.yml", "*.yaml"} {
+			files, err := fs.Glob(source, pattern)
+			if err != nil {
+				return nil, err
+			}
+			for _, file := range files {
+				if !strings.HasPrefix(file, "_") && !slices.Contains(templates, file) {
+					templates = append(templates, file)
+				}
+			}
+		}
+	}
+	sort.Strings(templates)
+	return templates, nil
+}
+
+// Dockerfiles returns the names of the Dockerfile templates (*.Dockerfile).
+func (e *Engine) Dockerfiles() ([]string, error) {
+	return e.templatesWithSuffix(".Dockerfile")
+}
+
+// ComposeFiles returns the names of the compose file templates (*.yml, *.yaml).
+func (e *Engine) ComposeFiles() ([]string, error) {
+	return e.templatesWithSuffix(".yml", ".yaml")
+}
+
+// BaseComposeFiles returns the compose file templates which can be the compose file of a workspace:
+// the ones defining the build of the web IDE service. The other ones are overrides (e.g. compose.offload.yml).
+func (e *Engine) BaseComposeFiles() ([]string, error) {
+	return e.composeFilesWhere(true)
+}
+
+// OverrideComposeFiles returns the compose file templates which are not base compose files.
+func (e *Engine) OverrideComposeFiles() ([]string, error) {
+	return e.composeFilesWhere(false)
+}
+
+func (e *Engine) composeFilesWhere(base bool) ([]string, error) {
+	composeFiles, err := e.ComposeFiles()
+	if err != nil {
+		return nil, err
+	}
+	kept := []string{}
+	for _, name := range composeFiles {
+		content, err := e.readTemplate(name)
+		if err != nil {
+			return nil, err
+		}
+		if isBaseComposeFile(content) == base {
+			kept = append(kept, name)
+		}
+	}
+	return kept, nil
+}
+
+// isBaseComposeFile reports whether a compose file defines the build of the web IDE service.
+func isBaseComposeFile(content []byte) bool {
+	var compose struct {
+		Services map[string]struct {
+			Build any `yaml:"build"`
+		} `yaml:"services"`
+	}
+	if err := yaml.Unmarshal(content, &compose); err != nil {
+		return false
+	}
+	return compose.Services[webIDEService].Build != nil
+}
+
+func (e *Engine) templatesWithSuffix(suffixes ...string) ([]string, error) {
+	templates, err := e.Templates()
+	if err != nil {
+		return nil, err
+	}
+	kept := []string{}
+	for _, name := range templates {
+		if slices.ContainsFunc(suffixes, func(suffix string) bool { return strings.HasSuffix(name, suffix) }) {
+			kept = append(kept, name)
+		}
+	}
+	return kept, nil
+}
+
+// ReadTemplate returns the content of a template.
+func (e *Engine) ReadTemplate(name string) ([]byte, error) {
+	// a template name is a file name of the templates directory, never a path
+	if name == "" || name != filepath.Base(name) || strings.HasPrefix(name, ".") {
+		return nil, fmt.Errorf("%w: %s", ErrTemplateNotFound, name)
+	}
+	templates, err := e.Templates()
+	if err != nil {
+		return nil, err
+	}
+	if !slices.Contains(templates, name) {
+		return nil, fmt.Errorf("%w: %s", ErrTemplateNotFound, name)
+	}
+	return e.readTemplate(name)
+}
+
+// readTemplate returns the content of a template of the templates directory,
+// or else of the default templates.
+func (e *Engine) readTemplate(name string) ([]byte, error) {
+	for _, source := range e.templateSources() {
+		data, err := fs.ReadFile(source, name)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		return data, err
+	}
+	return nil, fmt.Errorf("%w: %s", ErrTemplateNotFound, name)
+}
+
+// ReadWorkspaceFile returns the content of a file of a workspace (see WorkspaceFiles).
+func (e *Engine) ReadWorkspaceFile(projectsDirectory, workspaceName, file string) ([]byte, error) {
+	name, ok := WorkspaceFiles[file]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrFileNotFound, file)
+	}
+	if workspaceName == "" || workspaceName != filepath.Base(workspaceName) || strings.HasPrefix(workspaceName, ".") {
+		return nil, fmt.Errorf("%w: %s", ErrWorkspaceNotFound, workspaceName)
+	}
+	if err := e.exists(projectsDirectory, workspaceName); err != nil {
+		return nil, err
+	}
+	if name == DefaultComposeFileName {
+		name = e.composeFileName(projectsDirectory, workspaceName)
+	}
+	data, err := os.ReadFile(filepath.Join(e.Dir(projectsDirectory, workspaceName), name))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("%w: %s of workspace %s", ErrFileNotFound, file, workspaceName)
+		}
+		return nil, err
+	}
+	return data, nil
+}
@@ -0,0 +1,194 @@
+package workspace
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"path"
+	"strings"
+)
+
+var ErrInvalidRepository = errors.New("invalid repository")
+
+const (
+	ProtocolSSH   = "ssh"
+	ProtocolHTTPS = "https"
+)
+
+// Remote is the location of the repository to clone.
+type Remote struct {
+	Protocol string // ssh or https
+	Host     string
+	Port     string // empty for the default port of the protocol
+	User     string // ssh user (git by default), or https user name used with the token
+	Path     string // e.g. k33g/compose-codex.git
+}
+
+// ParseRemote builds the remote from the git_host and repository arguments.
+// repository can be:
+//   - a path on the git host: "k33g/compose-codex.git"
+//   - a scp-like address: "git@gitlab.example.com:team/project.git"
+//   - a full URL: "ssh://git@gitlab.example.com:2222/team/project.git", "https://bitbucket.org/team/project.git"
+//
+// gitHost is only used with a path. It can be "github.com", "gitlab.example.com:2222"
+// or a URL to select the protocol ("https://gitlab.example.com").
+func ParseRemote(gitHost, repository string) (*Remote, error) {
+	repository = strings.TrimSpace(repository)
+	gitHost = strings.TrimSpace(gitHost)
+	if repository == "" {
+		return nil, fmt.Errorf("%w: empty repository", ErrInvalidRepository)
+	}
+
+	// full URL
+	if strings.Contains(repository, "://") {
+		return parseRemoteURL(repository)
+	}
+	// scp-like address: [user@]host:path
+	if host, repoPath, found := strings.Cut(repository, ":"); found && !strings.Contains(host, "/") {
+		user := "git"
+		if u, h, found := strings.Cut(host, "@"); found {
+			user, host = u, h
+		}
+		return newRemote(ProtocolSSH, host, "", user, repoPath)
+	}
+	// path on the git host
+	if gitHost == "" {
+		return nil, fmt.Errorf("%w: git_host is required when repository is not a URL", ErrInvalidRepository)
+	}
+	if strings.Contains(gitHost, "://") {
+		remote, err := parseRemoteURL(strings.TrimRight(gitHost, "/") + "/" + repository)
+		if err != nil {
+			return nil, err
+		}
+		return remote, nil
+	}
+	host, port := gitHost, ""
+	if h, p, err := net.SplitHostPort(gitHost); err == nil {
+		host, port = h, p
+	}
+	return newRemote(ProtocolSSH, host, port, "git", repository)
+}
+
+func parseRemoteURL(rawURL string) (*Remote, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidRepository, err)
+	}
+	if u.User != nil {
+		if _, hasPassword := u.User.Password(); hasPassword {
+			return nil, fmt.Errorf("%w: do not put credentials in the URL, use git_token", ErrInvalidRepository)
+		}
+	}
+	switch u.Scheme {
+	case "ssh":
+		user := "git"
+		if u.User != nil {
+			user = u.User.Username()
+		}
+		return newRemote(ProtocolSSH, u.Hostname(), u.Port(), user, u.Path)
+	case "http":
+		// the token would be sent in clear, and CloneURL always gives https
+		return nil, fmt.Errorf("%w: http is not supported, use https", ErrInvalidRepository)
+	case "https":
+		user := ""
+		if u.User != nil {
+			user = u.User.Username()
+		}
+		return newRemote(ProtocolHTTPS, u.Hostname(), u.Port(), user, u.Path)
+	default:
+		return nil, fmt.Errorf("%w: unsupported scheme %s", ErrInvalidRepository, u.Scheme)
+	}
+}
+
+func newRemote(protocol, host, port, user, repoPath string) (*Remote, error) {
+	repoPath = strings.Trim(repoPath, "/")
+	if host == "" || repoPath == "" {
+		return nil, fmt.Errorf("%w: host and path are required", ErrInvalidRepository)
+	}
+	return &Remote{Protocol: protocol, Host: host, Port: port, User: user, Path: repoPath}, nil
+}
+
+// CloneURL returns the URL given to git clone.
+func (r *Remote) CloneURL() string {
+	switch r.Protocol {
+	case ProtocolHTTPS:
+		host := r.Host
+		if r.Port != "" {
+			host = net.JoinHostPort(r.Host, r.Port)
+		}
+		return "https://" + host + "/" + r.Path
+	default:
+		if r.Port == "" {
+			return r.User + "@" + r.Host + ":" + r.Path
+		}
+		return "ssh://" + r.User + "@" + net.JoinHostPort(r.Host, r.Port) + "/" + r.Path
+	}
+}
+
+// ProjectName returns the name of the directory created by git clone.
+func (r *Remote) ProjectName() string {
+	return strings.TrimSuffix(path.Base(r.Path), ".git")
+}
+
+// tokenUser returns the user name sent with an HTTPS token.
+// Each forge expects its own when the URL does not give one.
+func (r *Remote) tokenUser() string {
+	if r.User != "" {
+		return r.User
+	}
+	switch {
+	case r.Host == "github.com" || strings.HasSuffix(r.Host, ".github.com"):
+		return "x-access-token"
+	case r.Host == "bitbucket.org":
+		return "x-token-auth"
+	default:
+		// GitLab (gitlab.com and self-hosted)
+		return "oauth2"
+	}
+}
+
+// tokenEnv returns the environment giving the token to git through an HTTP header.
+// The token is neither in the command line nor in the .git/config of the clone.
+func (r *Remote) tokenEnv(token string) []string {
+	credentials := base64.StdEncoding.EncodeToString([]byte(r.tokenUser() + ":" + token))
+	return []string{
+		"GIT_CONFIG_COUNT=1",
+		"GIT_CONFIG_KEY_0=http.extraHeader",
+		"GIT_CONFIG_VALUE_0=Authorization: Basic " + credentials,
+		"GIT_TERMINAL_PROMPT=0",
+	}
+}
+
+// credentialsLine returns the entry of the git-credentials file used by the web IDE to push.
+func (r *Remote) credentialsLine(token string) string {
+	host := r.Host
+	if r.Port != "" {
+		host = net.JoinHostPort(r.Host, r.Port)
+	}
+	u := url.URL{Scheme: "https", User: url.UserPassword(r.tokenUser(), token), Host: host}
+	return u.String() + "\n"
+}
+
+// sshConfig returns the SSH configuration of the web IDE (keys/config) for the remote.
+// With the agent mode, there is no key file: ssh uses the forwarded agent.
+func (r *Remote) sshConfig(auth SSHAuth) string {
+	lines := []string{
+		"Host " + r.Host,
+		"    HostName " + r.Host,
+		"    User " + r.User,
+	}
+	if r.Port != "" {
+		lines = append(lines, "    Port "+r.Port)
+	}
+	if auth != SSHAuthAgent {
+		lines = append(lines, "    IdentityFile ~/.ssh/"+privateKeyName)
+	}
+	lines = append(lines,
+		"    UserKnownHostsFile ~/.ssh/known_hosts",
+		"    StrictHostKeyChecking yes",
+		"",
+	)
+	return strings.Join(lines, "\n")
+}
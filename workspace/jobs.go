@@ -0,0 +1,358 @@
+package workspace
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrJobNotFound = errors.New("job not found")
+
+type JobStatus string
+
+const (
+	JobRunning   JobStatus = "running"
+	JobSucceeded JobStatus = "succeeded"
+	JobFailed    JobStatus = "failed"
+	JobCancelled JobStatus = "cancelled"
+	// JobInterrupted is the status of the jobs running when the server stopped.
+	JobInterrupted JobStatus = "interrupted"
+)
+
+// maxFinishedJobs is the number of finished jobs kept in the history, the oldest are deleted.
+const maxFinishedJobs = 200
+
+// Job is a workspace operation run in the background.
+// It is persisted, with its log, in the jobs directory: <id>.json and <id>.log.
+type Job struct {
+	ID                string     `json:"id"`
+	Action            string     `json:"action"` // create, start, update, stop, remove, restore or purge
+	WorkspaceName     string     `json:"workspace_name"`
+	ProjectsDirectory string     `json:"projects_directory"`
+	Status            JobStatus  `json:"status"`
+	Progress          float64    `json:"progress"`
+	Total             float64    `json:"total"`
+	Message           string     `json:"message,omitempty"` // last progress message
+	Error             string     `json:"error,omitempty"`
+	Result            *Result    `json:"result,omitempty"`
+	CreatedAt         time.Time  `json:"created_at"`
+	FinishedAt        *time.Time `json:"finished_at,omitempty"`
+}
+
+// Finished reports whether the job is over.
+func (j *Job) Finished() bool {
+	return j.Status != JobRunning
+}
+
+// String renders the job as a human readable report.
+func (j *Job) String() string {
+	var builder strings.Builder
+	fmt.Fprintf(&builder, "Job %s: %s workspace %s, %s", j.ID, j.Action, j.WorkspaceName, j.Status)
+	if j.Status == JobRunning && j.Total > 0 {
+		fmt.Fprintf(&builder, " (%.0f%%)", j.Progress*100/j.Total)
+	}
+	builder.WriteString("\n")
+	if j.Message != "" && j.Status == JobRunning {
+		builder.WriteString(j.Message + "\n")
+	}
+	if j.Error != "" {
+		builder.WriteString("Error: " + j.Error + "\n")
+	}
+	if j.Result != nil {
+		builder.WriteString("\n" + j.Result.String())
+	}
+	return builder.String()
+}
+
+// Jobs runs the workspace operations in the background and keeps their history.
+type Jobs struct {
+	directory string
+
+	mutex   sync.Mutex
+	jobs    map[string]*Job
+	cancels map[string]context.CancelCauseFunc // of the running jobs
+	logs    map[string]*os.File                // of the running jobs
+}
+
+// NewJobs loads the history of the jobs of directory.
+// The jobs still running according to the history were interrupted by a stop of the server.
+func NewJobs(directory string) (*Jobs, error) {
+	jobs := &Jobs{
+		directory: directory,
+		jobs:      map[string]*Job{},
+		cancels:   map[string]context.CancelCauseFunc{},
+		logs:      map[string]*os.File{},
+	}
+	if err := os.MkdirAll(directory, 0700); err != nil {
+		return nil, err
+	}
+	files, err := filepath.Glob(filepath.Join(directory, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		var job Job
+		if err := json.Unmarshal(data, &job); err != nil {
+			slog.Warn(fmt.Sprintf("Ignoring the invalid job %s: %v", file, err))
+			continue
+		}
+		if !job.Finished() {
+			now := time.Now().UTC()
+			job.Status = JobInterrupted
+			job.Error = "the server stopped while the job was running"
+			job.FinishedAt = &now
+			if err := jobs.save(&job); err != nil {
+				return nil, err
+			}
+		}
+		jobs.jobs[job.ID] = &job
+	}
+	return jobs, nil
+}
+
+// Submit runs operation in the background and returns its job at once.
+// The job is cancelled after timeout, if not zero.
+func (j *Jobs) Submit(action, workspaceName, projectsDirectory string, timeout time.Duration, operation func(ctx context.Context) (*Result, error)) (*Job, error) {
+	id, err := newJobID()
+	if err != nil {
+		return nil, err
+	}
+	job := &Job{
+		ID:                id,
+		Action:            action,
+		WorkspaceName:     workspaceName,
+		ProjectsDirectory: projectsDirectory,
+		Status:            JobRunning,
+		CreatedAt:         time.Now().UTC(),
+	}
+	logFile, err := os.OpenFile(j.logPath(id), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	// the job outlives the tool call which submitted it
+	ctx, cancel := context.WithCancelCause(context.Background())
+	stop := context.CancelFunc(func() {})
+	if timeout > 0 {
+		ctx, stop = context.WithTimeoutCause(ctx, timeout, fmt.Errorf("%s job timed out after %s", action, timeout))
+	}
+	cancelJob := func(cause error) {
+		cancel(cause)
+		stop()
+	}
+
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	if err := j.save(job); err != nil {
+		logFile.Close()
+		cancelJob(nil)
+		return nil, err
+	}
+	j.jobs[id] = job
+	j.cancels[id] = cancelJob
+	j.logs[id] = logFile
+	j.prune()
+
+	go j.run(ctx, job, operation)
+	return j.copy(job), nil
+}
+
+func (j *Jobs) run(ctx context.Context, job *Job, operation func(ctx context.Context) (*Result, error)) {
+	result, err := operation(WithReporter(ctx, &jobReporter{jobs: j, id: job.ID}))
+
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	now := time.Now().UTC()
+	job.Result = result
+	job.FinishedAt = &now
+	switch {
+	case errors.Is(err, ErrCancelled):
+		job.Status = JobCancelled
+		job.Error = err.Error()
+	case err != nil:
+		job.Status = JobFailed
+		job.Error = err.Error()
+	default:
+		job.Status = JobSucceeded
+		job.Progress = job.Total
+	}
+	if err := j.save(job); err != nil {
+		slog.Error(fmt.Sprintf("Failed to save job %s: %v", job.ID, err))
+	}
+	j.cancels[job.ID](nil)
+	delete(j.cancels, job.ID)
+	j.logs[job.ID].Close()
+	delete(j.logs, job.ID)
+	log.Printf("Job %s (%s workspace %s): %s", job.ID, job.Action, job.WorkspaceName, job.Status)
+}
+
+// Get returns a copy of a job.
+func (j *Jobs) Get(id string) (*Job, error) {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	job, ok := j.jobs[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrJobNotFound, id)
+	}
+	return j.copy(job), nil
+}
+
+// List returns the jobs, the most recent first.
+// The jobs can be filtered by workspace and status (empty for all).
+func (j *Jobs) List(workspaceName string, status JobStatus) []Job {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	jobs := []Job{}
+	for _, job := range j.jobs {
+		if (workspaceName == "" || job.WorkspaceName == workspaceName) && (status == "" || job.Status == status) {
+			jobs = append(jobs, *j.copy(job))
+		}
+	}
+	sort.Slice(jobs, func(a, b int) bool {
+		return jobs[a].CreatedAt.After(jobs[b].CreatedAt)
+	})
+	return jobs
+}
+
+// Cancel cancels a running job. The operation is rolled back like a cancelled tool call,
+// the job is cancelled once it is.
+func (j *Jobs) Cancel(id string) (*Job, error) {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	job, ok := j.jobs[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrJobNotFound, id)
+	}
+	if cancel, running := j.cancels[id]; running {
+		cancel(errors.New("job cancelled"))
+	}
+	return j.copy(job), nil
+}
+
+// Log returns the output of the commands of a job, up to its last lines if lines is not zero.
+func (j *Jobs) Log(id string, lines int) (string, error) {
+	if _, err := j.Get(id); err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(j.logPath(id))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return "", nil
+		}
+		return "", err
+	}
+	output := string(data)
+	if lines > 0 {
+		all := strings.Split(strings.TrimRight(output, "\n"), "\n")
+		if len(all) > lines {
+			output = strings.Join(all[len(all)-lines:], "\n") + "\n"
+		}
+	}
+	return output, nil
+}
+
+// prune deletes the oldest finished jobs beyond maxFinishedJobs. The caller holds the mutex.
+func (j *Jobs) prune() {
+	finished := []*Job{}
+	for _, job := range j.jobs {
+		if job.Finished() {
+			finished = append(finished, job)
+		}
+	}
+	if len(finished) <= maxFinishedJobs {
+		return
+	}
+	sort.Slice(finished, func(a, b int) bool {
+		return finished[a].CreatedAt.Before(finished[b].CreatedAt)
+	})
+	for _, job := range finished[:len(finished)-maxFinishedJobs] {
+		delete(j.jobs, job.ID)
+		os.Remove(j.jobPath(job.ID))
+		os.Remove(j.logPath(job.ID))
+	}
+}
+
+// copy returns a copy of a job safe to read without the mutex. The caller holds the mutex.
+func (j *Jobs) copy(job *Job) *Job {
+	clone := *job
+	if job.Result != nil {
+		result := *job.Result
+		result.Steps = append([]Step{}, job.Result.Steps...)
+		clone.Result = &result
+	}
+	return &clone
+}
+
+// save writes a job, atomically. The caller holds the mutex.
+func (j *Jobs) save(job *Job) error {
+	data, err := json.MarshalIndent(job, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := j.jobPath(job.ID) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, j.jobPath(job.ID))
+}
+
+func (j *Jobs) jobPath(id string) string {
+	return filepath.Join(j.directory, id+".json")
+}
+
+func (j *Jobs) logPath(id string) string {
+	// the id is checked by Get before any read: it is never a path
+	return filepath.Join(j.directory, id+".log")
+}
+
+func newJobID() (string, error) {
+	random := make([]byte, 6)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	return "job-" + time.Now().UTC().Format("20060102-150405") + "-" + hex.EncodeToString(random), nil
+}
+
+// jobReporter records the progress of a job and writes the output of its commands into its log.
+type jobReporter struct {
+	jobs *Jobs
+	id   string
+}
+
+func (r *jobReporter) Progress(progress, total float64, message string) {
+	r.jobs.mutex.Lock()
+	defer r.jobs.mutex.Unlock()
+	job := r.jobs.jobs[r.id]
+	job.Progress = progress
+	job.Total = total
+	job.Message = message
+	if err := r.jobs.save(job); err != nil {
+		slog.Error(fmt.Sprintf("Failed to save job %s: %v", r.id, err))
+	}
+}
+
+func (r *jobReporter) Log(level LogLevel, step, line string) {
+	r.jobs.mutex.Lock()
+	defer r.jobs.mutex.Unlock()
+	prefix := ""
+	if level == LogError {
+		prefix = "ERROR "
+	}
+	fmt.Fprintf(r.jobs.logs[r.id], "%s %s%s: %s\n", time.Now().UTC().Format(time.RFC3339), prefix, step, line)
+}
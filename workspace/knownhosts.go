@@ -0,0 +1,298 @@
+package workspace
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+var (
+	ErrUnknownHost     = errors.New("unknown ssh host")
+	ErrHostKeyMismatch = errors.New("ssh host key mismatch")
+)
+
+// HostKeyMismatchError is returned when the key presented by a git host
+// is not the trusted one: either the host is impersonated, or it changed its key.
+type HostKeyMismatchError struct {
+	Host     string
+	Expected []string // trusted fingerprints
+	Actual   []string // fingerprints presented by the host, when known
+}
+
+func (e *HostKeyMismatchError) Error() string {
+	message := fmt.Sprintf("%v for %s: no trusted key", ErrHostKeyMismatch, e.Host)
+	if len(e.Expected) > 0 {
+		message = fmt.Sprintf("%v for %s: trusted fingerprints %s", ErrHostKeyMismatch, e.Host, strings.Join(e.Expected, ", "))
+	}
+	if len(e.Actual) > 0 {
+		message += ", presented " + strings.Join(e.Actual, ", ")
+	}
+	return message + " (possible man-in-the-middle attack)"
+}
+
+func (e *HostKeyMismatchError) Unwrap() error {
+	return ErrHostKeyMismatch
+}
+
+// pinnedFingerprints are the published SHA256 fingerprints of the host keys of the well-known forges.
+// Their keys are trusted only when they match.
+var pinnedFingerprints = map[string][]string{
+	"github.com": {
+		"SHA256:+DiY3wvvV6TuJJhbpZisF/zLDA0zPMSvHdkr4UvCOqU", // ed25519
+		"SHA256:p2QAMXNIC1TJYWeIOttrVc98/R1BUFWu3/LiyKgUfQM", // ecdsa
+		"SHA256:uNiVztksCsDhcc0u9e8BujQXVUpKZIDTMczCvj3tD2s", // rsa
+	},
+	"gitlab.com": {
+		"SHA256:eUXGGm1YGsMAS7vkcx6JOJdOGHPem5gQp4taiCfCLB8", // ed25519
+		"SHA256:HbW3g8zUjNSksFbqTiUWPWg2Bq1x8xdGUrliXFzSnUw", // ecdsa
+		"SHA256:ROQFvPThGrW4RuWLoL9tq9I9zJ42fK4XywyRtbOz/EQ", // rsa
+	},
+	"bitbucket.org": {
+		"SHA256:ybgmFkzwOSotHTHLJgHO0QN8L0xErw6vd0VhFA9m3SM", // ed25519
+		"SHA256:FC73VB6C4OQLSCrjEayhMp9UMxS97caD/Yyi2bhW/J0", // ecdsa
+		"SHA256:46OSHA1Rmj8E8ERTC6xkNcmGOw9oFxYr0WF6zWW8l1E", // rsa
+	},
+}
+
+// KnownHost is a trusted host key of the known_hosts store of the server.
+type KnownHost struct {
+	Host        string `json:"host"` // host or [host]:port, as in a known_hosts file
+	KeyType     string `json:"key_type"`
+	Fingerprint string `json:"fingerprint"`
+	Pinned      bool   `json:"pinned"` // the fingerprint is one of the published ones of the forge
+	line        string
+}
+
+// knownHostsPattern returns the host pattern of a known_hosts file for a host and a port.
+func knownHostsPattern(host, port string) string {
+	if port == "" || port == "22" {
+		return host
+	}
+	return "[" + host + "]:" + port
+}
+
+// KnownHosts returns the trusted host keys of the server.
+func (e *Engine) KnownHosts() ([]KnownHost, error) {
+	e.knownHostsMutex.Lock()
+	defer e.knownHostsMutex.Unlock()
+	return e.readKnownHosts()
+}
+
+func (e *Engine) readKnownHosts() ([]KnownHost, error) {
+	knownHosts := []KnownHost{}
+	file, err := os.Open(e.KnownHostsFile)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return knownHosts, nil
+		}
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		knownHost, err := parseKnownHost(line)
+		if err != nil {
+			return nil, fmt.Errorf("invalid known_hosts entry in %s: %w", e.KnownHostsFile, err)
+		}
+		knownHosts = append(knownHosts, knownHost)
+	}
+	return knownHosts, scanner.Err()
+}
+
+func parseKnownHost(line string) (KnownHost, error) {
+	_, hosts, key, _, _, err := ssh.ParseKnownHosts([]byte(line))
+	if err != nil {
+		return KnownHost{}, err
+	}
+	host := strings.Join(hosts, ",")
+	fingerprint := ssh.FingerprintSHA256(key)
+	hostname, _, _ := strings.Cut(strings.TrimPrefix(host, "["), "]")
+	return KnownHost{
+		Host:        host,
+		KeyType:     key.Type(),
+		Fingerprint: fingerprint,
+		Pinned:      slices.Contains(pinnedFingerprints[hostname], fingerprint),
+		line:        line,
+	}, nil
+}
+
+// AddKnownHost trusts the keys of an SSH host (port is optional).
+// The keys are fetched with ssh-keyscan then checked: against the fingerprint if given,
+// against the pinned fingerprints for a well-known forge. Without fingerprint,
+// the keys of another host are trusted as they are presented (trust on first use).
+// The previous keys of the host are replaced.
+func (e *Engine) AddKnownHost(ctx context.Context, host, port, fingerprint string) ([]KnownHost, error) {
+	host, port = strings.TrimSpace(host), strings.TrimSpace(port)
+	// the host and the port are arguments of ssh-keyscan
+	if err := ValidateKnownHost(host, port); err != nil {
+		return nil, err
+	}
+	scanned, err := e.scanHostKeys(ctx, host, port)
+	if err != nil {
+		return nil, err
+	}
+
+	expected := pinnedFingerprints[host]
+	if fingerprint = strings.TrimSpace(fingerprint); fingerprint != "" {
+		if !strings.HasPrefix(fingerprint, "SHA256:") {
+			fingerprint = "SHA256:" + fingerprint
+		}
+		expected = []string{fingerprint}
+	}
+	trusted := scanned
+	if len(expected) > 0 {
+		trusted = []KnownHost{}
+		for _, knownHost := range scanned {
+			if slices.Contains(expected, knownHost.Fingerprint) {
+				trusted = append(trusted, knownHost)
+			}
+		}
+		if len(trusted) == 0 {
+			actual := []string{}
+			for _, knownHost := range scanned {
+				actual = append(actual, knownHost.Fingerprint)
+			}
+			return nil, &HostKeyMismatchError{Host: knownHostsPattern(host, port), Expected: expected, Actual: actual}
+		}
+	}
+
+	e.knownHostsMutex.Lock()
+	defer e.knownHostsMutex.Unlock()
+	knownHosts, err := e.readKnownHosts()
+	if err != nil {
+		return nil, err
+	}
+	pattern := knownHostsPattern(host, port)
+	knownHosts = slices.DeleteFunc(knownHosts, func(knownHost KnownHost) bool {
+		return knownHost.Host == pattern
+	})
+	knownHosts = append(knownHosts, trusted...)
+	if err := e.writeKnownHosts(knownHosts); err != nil {
+		return nil, err
+	}
+	return trusted, nil
+}
+
+// scanHostKeys fetches the host keys of an SSH server with ssh-keyscan.
+func (e *Engine) scanHostKeys(ctx context.Context, host, port string) ([]KnownHost, error) {
+	args := []string{"-T", "10", "-t", "ed25519,ecdsa,rsa"}
+	if port != "" {
+		args = append(args, "-p", port)
+	}
+	output, err := e.run(ctx, ".", nil, "ssh-keyscan", append(args, host)...)
+	if err != nil {
+		return nil, err
+	}
+	scanned := []KnownHost{}
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		_, _, key, _, _, err := ssh.ParseKnownHosts([]byte(line))
+		if err != nil {
+			continue // ssh-keyscan prints its comments on stderr, mixed with the keys
+		}
+		// the entry is stored with the host and port the workspaces use
+		line = knownHostsPattern(host, port) + " " + strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key)))
+		knownHost, err := parseKnownHost(line)
+		if err != nil {
+			return nil, err
+		}
+		scanned = append(scanned, knownHost)
+	}
+	if len(scanned) == 0 {
+		return nil, fmt.Errorf("%w: no host key returned by %s", ErrUnknownHost, knownHostsPattern(host, port))
+	}
+	return scanned, nil
+}
+
+func (e *Engine) writeKnownHosts(knownHosts []KnownHost) error {
+	if err := os.MkdirAll(filepath.Dir(e.KnownHostsFile), 0700); err != nil {
+		return err
+	}
+	var builder strings.Builder
+	for _, knownHost := range knownHosts {
+		builder.WriteString(knownHost.line + "\n")
+	}
+	tmp := e.KnownHostsFile + ".tmp"
+	if err := os.WriteFile(tmp, []byte(builder.String()), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, e.KnownHostsFile)
+}
+
+// hostKnownHosts returns the known_hosts entries of the host of the remote, to write into a workspace.
+// The keys of a well-known forge are added to the store the first time;
+// the other hosts must have been added with AddKnownHost.
+func (e *Engine) hostKnownHosts(ctx context.Context, remote *Remote) (string, error) {
+	pattern := knownHostsPattern(remote.Host, remote.Port)
+	lines := func() ([]string, error) {
+		knownHosts, err := e.KnownHosts()
+		if err != nil {
+			return nil, err
+		}
+		lines := []string{}
+		for _, knownHost := range knownHosts {
+			if knownHost.Host == pattern {
+				lines = append(lines, knownHost.line)
+			}
+		}
+		return lines, nil
+	}
+
+	found, err := lines()
+	if err != nil {
+		return "", err
+	}
+	if len(found) == 0 {
+		if _, pinned := pinnedFingerprints[remote.Host]; !pinned {
+			return "", fmt.Errorf("%w: %s is not in the known hosts of the server, add it with add_known_host", ErrUnknownHost, pattern)
+		}
+		if _, err := e.AddKnownHost(ctx, remote.Host, remote.Port, ""); err != nil {
+			return "", err
+		}
+		if found, err = lines(); err != nil {
+			return "", err
+		}
+	}
+	return strings.Join(found, "\n") + "\n", nil
+}
+
+// hostKeyError returns a HostKeyMismatchError when the output of ssh (through git)
+// reports that the host key is not the trusted one.
+func (e *Engine) hostKeyError(remote *Remote, output string) error {
+	if !strings.Contains(output, "REMOTE HOST IDENTIFICATION HAS CHANGED") &&
+		!strings.Contains(output, "Host key verification failed") {
+		return nil
+	}
+	mismatch := &HostKeyMismatchError{Host: knownHostsPattern(remote.Host, remote.Port), Expected: []string{}}
+	if knownHosts, err := e.KnownHosts(); err == nil {
+		for _, knownHost := range knownHosts {
+			if knownHost.Host == mismatch.Host {
+				mismatch.Expected = append(mismatch.Expected, knownHost.Fingerprint)
+			}
+		}
+	}
+	// e.g. "The fingerprint for the ED25519 key sent by the remote host is\nSHA256:..."
+	for _, field := range strings.Fields(output) {
+		if strings.HasPrefix(field, "SHA256:") {
+			mismatch.Actual = append(mismatch.Actual, strings.TrimSuffix(field, "."))
+		}
+	}
+	return mismatch
+}
@@ -0,0 +1,432 @@
+package workspace
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// rollbackTimeout bounds the commands undoing a cancelled operation,
+// which run once the context of the operation is done.
+const rollbackTimeout = 2 * time.Minute
+
+// StartOptions are the parameters of the start_workspace tool.
+// When HTTPPort is empty, the port of the workspace is used (allocated if it has none).
+type StartOptions struct {
+	ProjectsDirectory string
+	WorkspaceName     string
+	HTTPPort          string
+	OnBusy            OnBusy // when another operation runs on the workspace (fail by default)
+}
+
+// StopOptions are the parameters of the stop_workspace tool.
+type StopOptions struct {
+	ProjectsDirectory string
+	WorkspaceName     string
+	OnBusy            OnBusy
+}
+
+// UpdateOptions are the parameters of the update_workspace tool.
+type UpdateOptions struct {
+	ProjectsDirectory string
+	WorkspaceName     string
+	BuildArgs         map[string]string // overrides of the ARGs of the Dockerfile, an empty value removes one
+	Rebuild           bool              // rebuild and (re)start the web IDE with the new build args
+	OnBusy            OnBusy
+}
+
+// RemoveOptions are the parameters of the remove_workspace tool.
+type RemoveOptions struct {
+	ProjectsDirectory string
+	WorkspaceName     string
+	RemoveImage       bool // also remove the images built for the workspace
+	Permanent         bool // delete the workspace at once instead of moving it to the trash
+	OnBusy            OnBusy
+}
+
+// exists returns ErrWorkspaceNotFound when the workspace directory does not exist.
+func (e *Engine) exists(projectsDirectory, workspaceName string) error {
+	dir := e.Dir(projectsDirectory, workspaceName)
+	if _, err := os.Stat(dir); err != nil {
+		return fmt.Errorf("%w: %s", ErrWorkspaceNotFound, dir)
+	}
+	return nil
+}
+
+// Start builds and starts the web IDE of a workspace with Docker Compose (locally, not with Docker Offload).
+func (e *Engine) Start(ctx context.Context, options StartOptions) (*Result, error) {
+	result, ctx := newResult(ctx, "start", options.WorkspaceName, 3)
+	return result, e.start(ctx, result, options, false)
+}
+
+// start runs the steps of Start, recorded in result.
+// locked is true when the caller already holds the lock of the workspace (Update): it is not taken again.
+func (e *Engine) start(ctx context.Context, result *Result, options StartOptions, locked bool) error {
+	dir := e.Dir(options.ProjectsDirectory, options.WorkspaceName)
+
+	var manifest *Manifest
+	unlock := func() {}
+	defer func() { unlock() }()
+	err := result.do("check_workspace", func(step *Step) error {
+		if err := ValidateStart(options); err != nil {
+			return err
+		}
+		if !locked {
+			release, err := e.lock(ctx, options.ProjectsDirectory, options.WorkspaceName, "start", options.OnBusy)
+			if err != nil {
+				return err
+			}
+			unlock = release
+		}
+		var err error
+		manifest, err = e.begin(options.ProjectsDirectory, options.WorkspaceName, "start")
+		if err != nil {
+			return err
+		}
+		httpPort, err := e.startPort(options, manifest)
+		if err != nil {
+			return e.abort(manifest, err)
+		}
+		options.HTTPPort = httpPort
+		step.Message = fmt.Sprintf("Workspace found, building with HTTP port %s", httpPort)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	composeArgs := e.composeArgs(dir, manifest.composeFile())
+	composeStarted := false
+	err = func() error {
+		// with a deploy key, the repository is cloned once the key is added to it
+		if manifest != nil && manifest.SSHAuth == SSHAuthDeployKey && e.ProjectName(options.ProjectsDirectory, options.WorkspaceName) == "" {
+			remote, err := ParseRemote("", manifest.CloneURL)
+			if err != nil {
+				return err
+			}
+			if err := e.clone(ctx, result, dir, remote, manifest.SSHAuth, ""); err != nil {
+				return err
+			}
+			manifest.ProjectName = e.ProjectName(options.ProjectsDirectory, options.WorkspaceName)
+		}
+
+		err := result.do("stop_offload", func(step *Step) error {
+			// Docker Offload may not be installed or started: this is not an error
+			output, err := e.run(ctx, dir, nil, "docker", "offload", "stop", "--force")
+			step.Output = output
+			if err != nil {
+				step.Message = "Docker Offload not stopped (not running or not available)"
+				return nil
+			}
+			step.Message = "Docker Offload stopped"
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		return result.do("compose_up", func(step *Step) error {
+			composeStarted = true
+			// the plain progress of BuildKit gives the build steps to the reporter
+			output, err := e.run(ctx, dir, []string{"BUILDKIT_PROGRESS=plain"}, "docker", append(composeArgs, "up", "--build", "-d")...)
+			step.Output = output
+			// kept for the clients reading the build log of the workspace
+			if err := os.WriteFile(filepath.Join(dir, BuildLogName), []byte(output), 0644); err != nil {
+				slog.Error(fmt.Sprintf("Failed to write the build log of %s: %v", options.WorkspaceName, err))
+			}
+			if err != nil {
+				step.Message = "Failed to build and start the workspace"
+				if errors.Is(err, ErrCancelled) {
+					step.Message = "Build cancelled, the build processes were killed"
+				}
+				return err
+			}
+			step.Message = "Local workspace started successfully"
+			return nil
+		})
+	}()
+	if errors.Is(err, ErrCancelled) && composeStarted {
+		// the containers already created by the interrupted build are removed
+		result.rollback("rollback", func(step *Step) error {
+			rollbackCtx, cancel := context.WithTimeout(context.Background(), rollbackTimeout)
+			defer cancel()
+			output, err := e.run(rollbackCtx, dir, nil, "docker", append(composeArgs, "down")...)
+			step.Output = output
+			step.Message = "Containers of the cancelled start removed"
+			return err
+		})
+		if manifest != nil && manifest.previous == StateRunning {
+			manifest.previous = StateStopped
+		}
+	}
+	if err := e.finish(manifest, "start", StateRunning, err); err != nil {
+		return err
+	}
+
+	result.AccessURL = AccessURL(options.HTTPPort, e.ProjectName(options.ProjectsDirectory, options.WorkspaceName))
+	return nil
+}
+
+// Update changes the build args of a workspace: the overrides of the ARGs of its Dockerfile
+// (e.g. GO_VERSION), written into the build section of its compose file.
+// With Rebuild, the web IDE is then rebuilt and (re)started, otherwise the build args apply at the next start.
+func (e *Engine) Update(ctx context.Context, options UpdateOptions) (*Result, error) {
+	total := 2
+	if options.Rebuild {
+		total += 3
+	}
+	result, ctx := newResult(ctx, "update", options.WorkspaceName, total)
+	dir := e.Dir(options.ProjectsDirectory, options.WorkspaceName)
+
+	var manifest *Manifest
+	unlock := func() {}
+	defer func() { unlock() }()
+	err := result.do("check_workspace", func(step *Step) error {
+		if err := e.ValidateUpdate(options); err != nil {
+			return err
+		}
+		release, err := e.lock(ctx, options.ProjectsDirectory, options.WorkspaceName, "update", options.OnBusy)
+		if err != nil {
+			return err
+		}
+		unlock = release
+		manifest, err = e.begin(options.ProjectsDirectory, options.WorkspaceName, "update")
+		if err != nil {
+			return err
+		}
+		step.Message = "Workspace found"
+		return nil
+	})
+	if err != nil {
+		return result, err
+	}
+
+	err = result.do("update_build_args", func(step *Step) error {
+		composeFile := filepath.Join(dir, manifest.composeFile())
+		// the compose file holds the build args, edited by hand or not
+		buildArgs, err := composeBuildArgs(composeFile)
+		if err != nil {
+			return err
+		}
+		for name, value := range options.BuildArgs {
+			if value == "" {
+				delete(buildArgs, name)
+			} else {
+				buildArgs[name] = value
+			}
+		}
+		if err := setComposeBuildArgs(composeFile, buildArgs); err != nil {
+			return err
+		}
+		if manifest != nil {
+			manifest.BuildArgs = buildArgs
+		}
+		step.Message = "Build args updated: " + formatBuildArgs(options.BuildArgs)
+		if !options.Rebuild {
+			step.Message += ", applied at the next start"
+		}
+		return nil
+	})
+	// the state is unchanged: only the compose file was written
+	if err := e.abort(manifest, err); err != nil || !options.Rebuild {
+		return result, err
+	}
+	// the lock is kept until the workspace is rebuilt: no other operation runs in between
+	return result, e.start(ctx, result, StartOptions{
+		ProjectsDirectory: options.ProjectsDirectory,
+		WorkspaceName:     options.WorkspaceName,
+		OnBusy:            options.OnBusy,
+	}, true)
+}
+
+// composeArgs returns the docker compose command of a workspace, with its compose files:
+// composeFile (see Manifest.composeFile), and the mount of the SSH agent socket of the agent mode.
+func (e *Engine) composeArgs(dir, composeFile string) []string {
+	args := []string{"compose", "-f", composeFile}
+	if _, err := os.Stat(filepath.Join(dir, sshAgentOverrideName)); err == nil {
+		args = append(args, "-f", sshAgentOverrideName)
+	}
+	return args
+}
+
+// startPort reserves the HTTP port of a start: the port asked, or the one of the workspace.
+// The port is written into the .env of the workspace, read by compose.yml.
+func (e *Engine) startPort(options StartOptions, manifest *Manifest) (string, error) {
+	dir := e.Dir(options.ProjectsDirectory, options.WorkspaceName)
+	envPath := filepath.Join(dir, ".env")
+	port := options.HTTPPort
+	if port == "" && manifest != nil {
+		port = manifest.HTTPPort
+	}
+	if port == "" {
+		// the workspaces created before the manifests only have their .env
+		if data, err := os.ReadFile(envPath); err == nil {
+			for _, line := range strings.Split(string(data), "\n") {
+				if value, ok := strings.CutPrefix(strings.TrimSpace(line), "HTTP_PORT="); ok {
+					port = value
+				}
+			}
+		}
+	}
+	port, err := e.reservePort(options.ProjectsDirectory, options.WorkspaceName, port)
+	if err != nil {
+		return "", err
+	}
+	if manifest != nil {
+		manifest.HTTPPort = port
+	}
+	return port, os.WriteFile(envPath, []byte("HTTP_PORT="+port+"\n"), 0644)
+}
+
+// Stop stops and removes the containers of a workspace.
+func (e *Engine) Stop(ctx context.Context, options StopOptions) (*Result, error) {
+	result, ctx := newResult(ctx, "stop", options.WorkspaceName, 2)
+	dir := e.Dir(options.ProjectsDirectory, options.WorkspaceName)
+
+	var manifest *Manifest
+	unlock := func() {}
+	defer func() { unlock() }()
+	err := result.do("check_workspace", func(step *Step) error {
+		if err := ValidateStop(options); err != nil {
+			return err
+		}
+		release, err := e.lock(ctx, options.ProjectsDirectory, options.WorkspaceName, "stop", options.OnBusy)
+		if err != nil {
+			return err
+		}
+		unlock = release
+		manifest, err = e.begin(options.ProjectsDirectory, options.WorkspaceName, "stop")
+		if err != nil {
+			return err
+		}
+		step.Message = "Workspace found"
+		return nil
+	})
+	if err != nil {
+		return result, err
+	}
+
+	err = result.do("compose_down", func(step *Step) error {
+		output, err := e.run(ctx, dir, nil, "docker", append(e.composeArgs(dir, manifest.composeFile()), "down")...)
+		step.Output = output
+		if err != nil {
+			step.Message = "Failed to stop the workspace"
+			return err
+		}
+		step.Message = "Local workspace stopped successfully"
+		return nil
+	})
+	if err := e.finish(manifest, "stop", StateStopped, err); err != nil {
+		return result, err
+	}
+
+	return result, nil
+}
+
+// Remove tears down the compose project of a workspace: its containers (a running workspace is stopped)
+// and networks. Then the workspace is moved to the trash (Result.Trashed), its volumes and images removed
+// when it is purged (see PurgeTrash). A permanent remove, or a remove without trash retention, also removes
+// the volumes and, with RemoveImage, the built images, then deletes the directory. Result.Reclaimed reports
+// what was removed, the containers and networks only for a workspace moved to the trash.
+func (e *Engine) Remove(ctx context.Context, options RemoveOptions) (*Result, error) {
+	result, ctx := newResult(ctx, "remove", options.WorkspaceName, 3)
+	dir := e.Dir(options.ProjectsDirectory, options.WorkspaceName)
+
+	var manifest *Manifest
+	unlock := func() {}
+	defer func() { unlock() }()
+	err := result.do("check_workspace", func(step *Step) error {
+		if err := ValidateRemove(options); err != nil {
+			return err
+		}
+		release, err := e.lock(ctx, options.ProjectsDirectory, options.WorkspaceName, "remove", options.OnBusy)
+		if err != nil {
+			return err
+		}
+		unlock = release
+		manifest, err = e.begin(options.ProjectsDirectory, options.WorkspaceName, "remove")
+		if err != nil {
+			return err
+		}
+		step.Message = "Workspace found, removing"
+		return nil
+	})
+	if err != nil {
+		return result, err
+	}
+
+	permanent := options.Permanent || e.TrashRetention <= 0
+	reclaimed := &RemoveReport{Containers: []string{}, Networks: []string{}, Volumes: []string{}, Images: []string{}}
+	composeArgs := e.composeArgs(dir, manifest.composeFile())
+	err = result.do("compose_down", func(step *Step) error {
+		if _, err := os.Stat(filepath.Join(dir, manifest.composeFile())); err != nil {
+			// the creation failed before the templates were copied
+			step.Message = "No compose file, nothing to tear down"
+			return nil
+		}
+		if !permanent {
+			output, err := e.run(ctx, dir, nil, "docker", append(composeArgs, "down", "--remove-orphans")...)
+			step.Output = output
+			if err != nil {
+				step.Message = "Failed to stop the compose project"
+				return err
+			}
+			reclaimed.parseComposeDown(output, nil)
+			step.Message = fmt.Sprintf("Compose project stopped, volumes and images kept in the trash: %s", reclaimed.summary())
+			return nil
+		}
+		args := append(slices.Clone(composeArgs), "down", "--volumes", "--remove-orphans")
+		imageSizes := map[string]int64{}
+		if options.RemoveImage {
+			// the images are measured before they are removed
+			imageSizes = e.composeImageSizes(ctx, dir, composeArgs)
+			args = append(args, "--rmi", "local")
+		}
+		output, err := e.run(ctx, dir, nil, "docker", args...)
+		step.Output = output
+		if err != nil {
+			step.Message = "Failed to tear down the compose project"
+			return err
+		}
+		reclaimed.parseComposeDown(output, imageSizes)
+		step.Message = fmt.Sprintf("Compose project removed: %s", reclaimed.summary())
+		return nil
+	})
+	if err != nil {
+		return result, e.finish(manifest, "remove", StateRemoving, err)
+	}
+
+	if !permanent {
+		if err := e.moveToTrash(result, manifest, options); err != nil {
+			return result, e.finish(manifest, "remove", StateRemoving, err)
+		}
+		reclaimed.KeptInTrash = true
+		result.Reclaimed = reclaimed
+		return result, nil
+	}
+
+	err = result.do("delete_files", func(step *Step) error {
+		reclaimed.FilesSize = directorySize(dir)
+		if err := os.RemoveAll(dir); err != nil {
+			return err
+		}
+		result.Reclaimed = reclaimed
+		step.Message = fmt.Sprintf("Directory %s deleted (%s)", dir, formatSize(reclaimed.FilesSize))
+		if err := e.releasePort(options.ProjectsDirectory, options.WorkspaceName); err != nil {
+			slog.Error(fmt.Sprintf("Failed to release the port of %s: %v", options.WorkspaceName, err))
+		}
+		return nil
+	})
+	if err != nil {
+		// the manifest is gone only when the directory is gone
+		return result, e.finish(manifest, "remove", StateRemoving, err)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,135 @@
+package workspace
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// fakeDocker puts first in the PATH a docker command recording its arguments.
+// It returns a function reading the recorded commands.
+func fakeDocker(t *testing.T) func() []string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake docker command is a shell script")
+	}
+	dir := t.TempDir()
+	calls := filepath.Join(dir, "calls")
+	script := "#!/bin/sh\necho \"$*\" >> " + calls + "\n"
+	if err := os.WriteFile(filepath.Join(dir, "docker"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return func() []string {
+		data, err := os.ReadFile(calls)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return strings.Split(strings.TrimSpace(string(data)), "\n")
+	}
+}
+
+// The compose commands of a workspace use its compose file, not compose.yml.
+func TestComposeFileOfTheWorkspace(t *testing.T) {
+	calls := fakeDocker(t)
+	projects := t.TempDir()
+	config := t.TempDir()
+	engine := NewEngine(
+		WithPortsFile(filepath.Join(config, "ports.json")),
+		WithTrashFile(filepath.Join(config, "trash.json")),
+	)
+	dir := engine.Dir(projects, "ws1")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	compose := "services:\n  web-ide:\n    build: .\n"
+	if err := os.WriteFile(filepath.Join(dir, "compose.dev.yml"), []byte(compose), 0644); err != nil {
+		t.Fatal(err)
+	}
+	manifest := &Manifest{WorkspaceName: "ws1", ProjectsDirectory: projects, ComposeFileName: "compose.dev.yml", State: StateRunning}
+	if err := engine.SaveManifest(manifest); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	if _, err := engine.Status(ctx, projects, "ws1"); err != nil {
+		t.Fatalf("Status: %v", err)
+	}
+	if _, err := engine.Stop(ctx, StopOptions{ProjectsDirectory: projects, WorkspaceName: "ws1"}); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+	data, err := engine.ReadWorkspaceFile(projects, "ws1", "compose.yml")
+	if err != nil || string(data) != compose {
+		t.Errorf("ReadWorkspaceFile(compose.yml) = %q, %v, want the content of compose.dev.yml", data, err)
+	}
+	if _, err := engine.Remove(ctx, RemoveOptions{ProjectsDirectory: projects, WorkspaceName: "ws1"}); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+	if _, err := engine.PurgeTrash(ctx, PurgeOptions{ProjectsDirectory: projects}); err != nil {
+		t.Fatalf("PurgeTrash: %v", err)
+	}
+
+	want := []string{
+		"compose -f compose.dev.yml ps --all --format json",
+		"compose -f compose.dev.yml down",
+		"compose -f compose.dev.yml down --remove-orphans",
+		"compose -f compose.dev.yml -p ws1 down --volumes --remove-orphans",
+	}
+	if got := calls(); !slices.Equal(got, want) {
+		t.Errorf("docker commands:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+// The workspaces created before the manifests use compose.yml.
+func TestComposeFileWithoutManifest(t *testing.T) {
+	calls := fakeDocker(t)
+	projects := t.TempDir()
+	engine := NewEngine()
+	if err := os.Mkdir(engine.Dir(projects, "ws1"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := engine.Stop(context.Background(), StopOptions{ProjectsDirectory: projects, WorkspaceName: "ws1"}); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+	if got, want := calls(), []string{"compose -f compose.yml down"}; !slices.Equal(got, want) {
+		t.Errorf("docker commands = %q, want %q", got, want)
+	}
+}
+
+// update_workspace writes the build args into the compose file of the workspace.
+func TestUpdateComposeFileOfTheWorkspace(t *testing.T) {
+	projects := t.TempDir()
+	engine := NewEngine()
+	dir := engine.Dir(projects, "ws1")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{
+		"Dockerfile":      "FROM scratch\nARG GO_VERSION=1.24.4\n",
+		"compose.dev.yml": "services:\n  web-ide:\n    build: .\n",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	manifest := &Manifest{WorkspaceName: "ws1", ProjectsDirectory: projects, ComposeFileName: "compose.dev.yml", State: StateStopped}
+	if err := engine.SaveManifest(manifest); err != nil {
+		t.Fatal(err)
+	}
+
+	options := UpdateOptions{ProjectsDirectory: projects, WorkspaceName: "ws1", BuildArgs: map[string]string{"GO_VERSION": "1.25.0"}}
+	if _, err := engine.Update(context.Background(), options); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	args, err := composeBuildArgs(filepath.Join(dir, "compose.dev.yml"))
+	if err != nil || args["GO_VERSION"] != "1.25.0" {
+		t.Errorf("build args of compose.dev.yml = %v, %v, want GO_VERSION 1.25.0", args, err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "compose.yml")); !os.IsNotExist(err) {
+		t.Errorf("compose.yml written: %v", err)
+	}
+}
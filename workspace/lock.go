@@ -0,0 +1,134 @@
+package workspace
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+var ErrWorkspaceBusy = errors.New("workspace busy")
+
+// BusyError is returned when an operation cannot run because another one runs on the same workspace.
+type BusyError struct {
+	Workspace string
+	Action    string // the running operation
+	Since     time.Time
+}
+
+func (e *BusyError) Error() string {
+	return fmt.Sprintf("%v: %s of workspace %s in progress since %s", ErrWorkspaceBusy, e.Action, e.Workspace, e.Since.Format(time.TimeOnly))
+}
+
+func (e *BusyError) Unwrap() error {
+	return ErrWorkspaceBusy
+}
+
+// OnBusy is what an operation does when another one runs on the same workspace.
+type OnBusy string
+
+const (
+	// OnBusyFail fails at once with a *BusyError.
+	OnBusyFail OnBusy = "fail"
+	// OnBusyWait waits for the running operation to finish (or the operation to be cancelled).
+	OnBusyWait OnBusy = "wait"
+)
+
+// workspaceLock serializes the operations of a workspace.
+type workspaceLock struct {
+	slot  chan struct{} // holds a value while an operation runs
+	users int           // operations running or waiting, guarded by Engine.locksMutex
+
+	mutex  sync.Mutex
+	action string
+	since  time.Time
+}
+
+func (l *workspaceLock) holder() (string, time.Time) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.action, l.since
+}
+
+// lockKey returns the key of the lock of a workspace in Engine.locks.
+func (e *Engine) lockKey(projectsDirectory, workspaceName string) string {
+	// the same workspace can be given with a relative or an absolute projects directory
+	key := e.Dir(projectsDirectory, workspaceName)
+	if abs, err := filepath.Abs(key); err == nil {
+		key = abs
+	}
+	return key
+}
+
+// useLock returns the lock of a workspace for an operation, which calls unuseLock when done with it.
+// The locks are kept while operations use them: a removed or purged workspace leaves none.
+func (e *Engine) useLock(key string) *workspaceLock {
+	e.locksMutex.Lock()
+	defer e.locksMutex.Unlock()
+	if e.locks == nil {
+		e.locks = map[string]*workspaceLock{}
+	}
+	lock, ok := e.locks[key]
+	if !ok {
+		lock = &workspaceLock{slot: make(chan struct{}, 1)}
+		e.locks[key] = lock
+	}
+	lock.users++
+	return lock
+}
+
+func (e *Engine) unuseLock(key string, lock *workspaceLock) {
+	e.locksMutex.Lock()
+	defer e.locksMutex.Unlock()
+	lock.users--
+	if lock.users == 0 {
+		delete(e.locks, key)
+	}
+}
+
+// lock reserves the workspace for action until the returned function is called.
+// The read-only operations (status, list, files) do not lock.
+func (e *Engine) lock(ctx context.Context, projectsDirectory, workspaceName, action string, onBusy OnBusy) (func(), error) {
+	key := e.lockKey(projectsDirectory, workspaceName)
+	lock := e.useLock(key)
+	select {
+	case lock.slot <- struct{}{}:
+	default:
+		running, since := lock.holder()
+		if onBusy != OnBusyWait {
+			e.unuseLock(key, lock)
+			return nil, &BusyError{Workspace: workspaceName, Action: running, Since: since}
+		}
+		if tracker := trackerFrom(ctx); tracker != nil {
+			tracker.line(fmt.Sprintf("Waiting for the %s of workspace %s, in progress since %s", running, workspaceName, since.Format(time.TimeOnly)))
+		}
+		select {
+		case lock.slot <- struct{}{}:
+		case <-ctx.Done():
+			e.unuseLock(key, lock)
+			return nil, cancelError(ctx)
+		}
+	}
+	lock.mutex.Lock()
+	lock.action = action
+	lock.since = time.Now()
+	lock.mutex.Unlock()
+	return func() {
+		<-lock.slot
+		e.unuseLock(key, lock)
+	}, nil
+}
+
+// Operation returns the operation running on a workspace, if any.
+func (e *Engine) Operation(projectsDirectory, workspaceName string) string {
+	e.locksMutex.Lock()
+	lock, ok := e.locks[e.lockKey(projectsDirectory, workspaceName)]
+	e.locksMutex.Unlock()
+	if !ok || len(lock.slot) == 0 {
+		return ""
+	}
+	action, _ := lock.holder()
+	return action
+}
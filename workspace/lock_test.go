@@ -0,0 +1,66 @@
+package workspace
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLock(t *testing.T) {
+	engine := NewEngine()
+	projects := t.TempDir()
+	ctx := context.Background()
+
+	if operation := engine.Operation(projects, "ws1"); operation != "" {
+		t.Errorf("Operation of an idle workspace = %q", operation)
+	}
+	release, err := engine.lock(ctx, projects, "ws1", "start", OnBusyFail)
+	if err != nil {
+		t.Fatalf("lock: %v", err)
+	}
+	if operation := engine.Operation(projects, "ws1"); operation != "start" {
+		t.Errorf("Operation = %q, want start", operation)
+	}
+	// the other workspaces are not busy
+	if other, err := engine.lock(ctx, projects, "ws2", "stop", OnBusyFail); err != nil {
+		t.Errorf("lock of another workspace: %v", err)
+	} else {
+		other()
+	}
+
+	_, err = engine.lock(ctx, projects, "ws1", "remove", OnBusyFail)
+	var busy *BusyError
+	if !errors.As(err, &busy) || busy.Action != "start" || !errors.Is(err, ErrWorkspaceBusy) {
+		t.Errorf("lock of a busy workspace = %v, want a *BusyError naming start", err)
+	}
+	waiting, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if _, err := engine.lock(waiting, projects, "ws1", "remove", OnBusyWait); !errors.Is(err, ErrCancelled) {
+		t.Errorf("lock waiting until the cancellation = %v, want %v", err, ErrCancelled)
+	}
+
+	acquired := make(chan func())
+	go func() {
+		release, err := engine.lock(ctx, projects, "ws1", "remove", OnBusyWait)
+		if err != nil {
+			t.Errorf("lock waiting for its turn: %v", err)
+		}
+		acquired <- release
+	}()
+	release()
+	select {
+	case release = <-acquired:
+	case <-time.After(time.Second):
+		t.Fatal("the waiting lock was not acquired")
+	}
+	if operation := engine.Operation(projects, "ws1"); operation != "remove" {
+		t.Errorf("Operation = %q, want remove", operation)
+	}
+	release()
+
+	// the locks of the workspaces without operation are not kept
+	if len(engine.locks) != 0 {
+		t.Errorf("locks = %v, want none", engine.locks)
+	}
+}
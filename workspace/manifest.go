@@ -0,0 +1,140 @@
+package workspace
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ManifestFileName is the name of the file describing a workspace, at the root of its directory.
+const ManifestFileName = "manifest.json"
+
+// Manifest is the persistent description of a workspace.
+// The field names are the ones of the tool arguments.
+type Manifest struct {
+	WorkspaceName       string            `json:"workspace_name"`
+	ProjectsDirectory   string            `json:"projects_directory"`
+	Repository          string            `json:"repository,omitempty"`
+	CloneURL            string            `json:"clone_url,omitempty"`
+	GitHost             string            `json:"git_host,omitempty"`
+	GitUserName         string            `json:"git_user_name,omitempty"`
+	GitUserEmail        string            `json:"git_user_email,omitempty"`
+	KeyName             string            `json:"key_name,omitempty"`
+	SSHAuth             SSHAuth           `json:"ssh_auth,omitempty"`
+	DockerfileName      string            `json:"dockerfile_name,omitempty"` // the template of the workspace
+	ComposeFileName     string            `json:"compose_file_name,omitempty"`
+	OffloadOverrideName string            `json:"offload_override_name,omitempty"`
+	HTTPPort            string            `json:"http_port,omitempty"`
+	BuildArgs           map[string]string `json:"build_args,omitempty"`   // overrides of the ARGs of the Dockerfile
+	ProjectName         string            `json:"project_name,omitempty"` // directory of the cloned repository
+	State               State             `json:"state"`
+	FailedAction        string            `json:"failed_action,omitempty"` // operation that put the workspace in the failed state
+	LastError           string            `json:"last_error,omitempty"`
+	CreatedAt           time.Time         `json:"created_at,omitzero"`
+	StartedAt           *time.Time        `json:"started_at,omitempty"`
+	StoppedAt           *time.Time        `json:"stopped_at,omitempty"`
+
+	previous State // state before the running operation, restored when it is cancelled
+}
+
+// LastActivity returns the date of the last creation, start or stop of the workspace.
+func (m *Manifest) LastActivity() time.Time {
+	last := m.CreatedAt
+	for _, date := range []*time.Time{m.StartedAt, m.StoppedAt} {
+		if date != nil && date.After(last) {
+			last = *date
+		}
+	}
+	return last
+}
+
+// composeFile returns the compose file of a workspace: its compose_file_name, compose.yml
+// for the workspaces without manifest (nil) or created before the compose file could be chosen.
+func (m *Manifest) composeFile() string {
+	if m == nil || m.ComposeFileName == "" {
+		return DefaultComposeFileName
+	}
+	return m.ComposeFileName
+}
+
+// composeFileName returns the compose file of a workspace read from its manifest (see Manifest.composeFile),
+// for the callers not holding its manifest. A workspace whose manifest cannot be read uses compose.yml.
+func (e *Engine) composeFileName(projectsDirectory, workspaceName string) string {
+	manifest, err := e.LoadManifest(projectsDirectory, workspaceName)
+	if err != nil && !errors.Is(err, ErrWorkspaceNotFound) {
+		log.Printf("Using %s as the compose file of %s: %v", DefaultComposeFileName, workspaceName, err)
+	}
+	return manifest.composeFile()
+}
+
+// LoadManifest reads the manifest of a workspace.
+// It returns ErrWorkspaceNotFound when the workspace has no manifest.
+func (e *Engine) LoadManifest(projectsDirectory, workspaceName string) (*Manifest, error) {
+	data, err := os.ReadFile(filepath.Join(e.Dir(projectsDirectory, workspaceName), ManifestFileName))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("%w: no manifest for %s", ErrWorkspaceNotFound, workspaceName)
+		}
+		return nil, err
+	}
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("invalid manifest for %s: %w", workspaceName, err)
+	}
+	return &manifest, nil
+}
+
+// SaveManifest writes the manifest of a workspace.
+// The file is written then renamed, so a reader never sees a partial manifest.
+func (e *Engine) SaveManifest(manifest *Manifest) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(e.Dir(manifest.ProjectsDirectory, manifest.WorkspaceName), ManifestFileName)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// List returns the manifests of the workspaces of a projects directory, sorted by name.
+// A directory without manifest is listed with its name and the unknown state.
+func (e *Engine) List(projectsDirectory string) ([]Manifest, error) {
+	if err := ValidateProjectsDirectory(projectsDirectory); err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(projectsDirectory)
+	if err != nil {
+		return nil, err
+	}
+	manifests := []Manifest{}
+	for _, entry := range entries {
+		// the hidden directories are not workspaces (e.g. the trash)
+		if !entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		manifest, err := e.LoadManifest(projectsDirectory, entry.Name())
+		if err != nil {
+			manifests = append(manifests, Manifest{
+				WorkspaceName:     entry.Name(),
+				ProjectsDirectory: projectsDirectory,
+				State:             StateUnknown,
+			})
+			continue
+		}
+		manifests = append(manifests, *manifest)
+	}
+	sort.Slice(manifests, func(i, j int) bool {
+		return manifests[i].WorkspaceName < manifests[j].WorkspaceName
+	})
+	return manifests, nil
+}
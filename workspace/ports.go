@@ -0,0 +1,208 @@
+package workspace
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+)
+
+var (
+	ErrInvalidPort = errors.New("invalid port")
+	ErrPortInUse   = errors.New("port in use")
+	ErrNoFreePort  = errors.New("no free port")
+)
+
+// PortConflictError is returned when the port asked for a workspace is already used:
+// reserved by another workspace, or listened on by another process of the host.
+type PortConflictError struct {
+	Port   int
+	Holder *PortReservation // nil when a process of the host uses the port
+}
+
+func (e *PortConflictError) Error() string {
+	if e.Holder == nil {
+		return fmt.Sprintf("%v: %d is used by another process of the host", ErrPortInUse, e.Port)
+	}
+	return fmt.Sprintf("%v: %d is reserved by workspace %s of %s", ErrPortInUse, e.Port, e.Holder.WorkspaceName, e.Holder.ProjectsDirectory)
+}
+
+func (e *PortConflictError) Unwrap() error {
+	return ErrPortInUse
+}
+
+// PortReservation is an HTTP port reserved for the web IDE of a workspace.
+type PortReservation struct {
+	Port              int       `json:"port"`
+	WorkspaceName     string    `json:"workspace_name"`
+	ProjectsDirectory string    `json:"projects_directory"`
+	ReservedAt        time.Time `json:"reserved_at,omitzero"`
+}
+
+// pendingReservationTimeout is how long the reservation of a workspace being created
+// is kept without its directory: the creation makes the directory right after the reservation.
+const pendingReservationTimeout = 10 * time.Minute
+
+func (r PortReservation) holds(projectsDirectory, workspaceName string) bool {
+	return r.WorkspaceName == workspaceName && r.ProjectsDirectory == absPath(projectsDirectory)
+}
+
+// stale reports whether the workspace was deleted without remove_workspace.
+// A workspace being created has a reservation but no directory yet: its reservation
+// is not stale until pendingReservationTimeout, so that a concurrent creation asking
+// for the same port cannot take it over. Only the conflicts with a stale reservation ignore it.
+func (r PortReservation) stale() bool {
+	_, err := os.Stat(filepath.Join(r.ProjectsDirectory, r.WorkspaceName))
+	return errors.Is(err, fs.ErrNotExist) && time.Since(r.ReservedAt) > pendingReservationTimeout
+}
+
+// absPath returns the absolute path of the projects directory of a reservation:
+// the table is shared by the projects directories.
+func absPath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return filepath.Clean(path)
+}
+
+// Ports returns the reservation table of the HTTP ports, sorted by port.
+func (e *Engine) Ports() ([]PortReservation, error) {
+	e.portsMutex.Lock()
+	defer e.portsMutex.Unlock()
+	return e.readPorts()
+}
+
+// readPorts reads the reservation table. The caller holds the mutex.
+func (e *Engine) readPorts() ([]PortReservation, error) {
+	reservations := []PortReservation{}
+	data, err := os.ReadFile(e.PortsFile)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return reservations, nil
+		}
+		return nil, err
+	}
+	var stored []PortReservation
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return nil, fmt.Errorf("invalid port reservations in %s: %w", e.PortsFile, err)
+	}
+	reservations = append(reservations, stored...)
+	sort.Slice(reservations, func(i, j int) bool {
+		return reservations[i].Port < reservations[j].Port
+	})
+	return reservations, nil
+}
+
+func (e *Engine) writePorts(reservations []PortReservation) error {
+	if err := os.MkdirAll(filepath.Dir(e.PortsFile), 0700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(reservations, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := e.PortsFile + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, e.PortsFile)
+}
+
+// reservePort reserves the HTTP port of a workspace and returns it.
+// An empty port is allocated: the port already reserved by the workspace if any,
+// otherwise the first free port of the range. An explicit port must not be reserved
+// by another workspace nor used by a process of the host; it replaces the previous
+// reservation of the workspace.
+func (e *Engine) reservePort(projectsDirectory, workspaceName, port string) (string, error) {
+	e.portsMutex.Lock()
+	defer e.portsMutex.Unlock()
+	reservations, err := e.readPorts()
+	if err != nil {
+		return "", err
+	}
+	reserved := map[int]PortReservation{}
+	current := 0
+	for _, reservation := range reservations {
+		reserved[reservation.Port] = reservation
+		if reservation.holds(projectsDirectory, workspaceName) {
+			current = reservation.Port
+		}
+	}
+
+	number := 0
+	if port != "" {
+		number, err = strconv.Atoi(port)
+		if err != nil || number < 1 || number > 65535 {
+			return "", fmt.Errorf("%w: %q", ErrInvalidPort, port)
+		}
+		if holder, ok := reserved[number]; ok && number != current {
+			if !holder.stale() {
+				return "", &PortConflictError{Port: number, Holder: &holder}
+			}
+			reservations = withoutReservation(reservations, holder.ProjectsDirectory, holder.WorkspaceName)
+		}
+		// the port of the workspace is used by its own web IDE when it runs
+		if number != current && !portFree(number) {
+			return "", &PortConflictError{Port: number}
+		}
+	} else if current != 0 {
+		number = current
+	} else {
+		for candidate := e.PortRangeStart; candidate <= e.PortRangeEnd; candidate++ {
+			if _, ok := reserved[candidate]; !ok && portFree(candidate) {
+				number = candidate
+				break
+			}
+		}
+		if number == 0 {
+			return "", fmt.Errorf("%w in the range %d-%d", ErrNoFreePort, e.PortRangeStart, e.PortRangeEnd)
+		}
+	}
+
+	if number != current {
+		reservations = withoutReservation(reservations, projectsDirectory, workspaceName)
+		reservations = append(reservations, PortReservation{Port: number, WorkspaceName: workspaceName, ProjectsDirectory: absPath(projectsDirectory), ReservedAt: time.Now().UTC()})
+		if err := e.writePorts(reservations); err != nil {
+			return "", err
+		}
+	}
+	return strconv.Itoa(number), nil
+}
+
+// releasePort deletes the reservation of a workspace.
+func (e *Engine) releasePort(projectsDirectory, workspaceName string) error {
+	e.portsMutex.Lock()
+	defer e.portsMutex.Unlock()
+	reservations, err := e.readPorts()
+	if err != nil {
+		return err
+	}
+	return e.writePorts(withoutReservation(reservations, projectsDirectory, workspaceName))
+}
+
+func withoutReservation(reservations []PortReservation, projectsDirectory, workspaceName string) []PortReservation {
+	kept := []PortReservation{}
+	for _, reservation := range reservations {
+		if !reservation.holds(projectsDirectory, workspaceName) {
+			kept = append(kept, reservation)
+		}
+	}
+	return kept
+}
+
+// portFree reports whether no process of the host listens on the port
+// (Docker publishes the ports on all the interfaces).
+func portFree(port int) bool {
+	listener, err := net.Listen("tcp", ":"+strconv.Itoa(port))
+	if err != nil {
+		return false
+	}
+	listener.Close()
+	return true
+}
@@ -0,0 +1,191 @@
+package workspace
+
+import (
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// freePortRange returns the first port of size consecutive free ports of the host.
+func freePortRange(t *testing.T, size int) int {
+	t.Helper()
+	for start := 47100; start < 48000; start += size {
+		free := true
+		for port := start; port < start+size && free; port++ {
+			free = portFree(port)
+		}
+		if free {
+			return start
+		}
+	}
+	t.Skip("no free port range")
+	return 0
+}
+
+func TestReservePort(t *testing.T) {
+	start := freePortRange(t, 3)
+	old := time.Now().Add(-time.Hour)
+	tests := []struct {
+		name         string
+		reservations []PortReservation // the workspaces other than deleted and pending are created
+		workspace    string
+		port         string // asked port, relative to start when it is a number
+		want         int    // reserved port, relative to start
+		err          error
+	}{
+		{
+			name:      "first port of the range",
+			workspace: "ws1",
+			want:      0,
+		},
+		{
+			name:         "first free port of the range",
+			reservations: []PortReservation{{Port: 0, WorkspaceName: "other"}},
+			workspace:    "ws1",
+			want:         1,
+		},
+		{
+			name:         "port already reserved by the workspace",
+			reservations: []PortReservation{{Port: 2, WorkspaceName: "ws1", ReservedAt: old}},
+			workspace:    "ws1",
+			want:         2,
+		},
+		{
+			name:         "explicit port replacing the reservation of the workspace",
+			reservations: []PortReservation{{Port: 0, WorkspaceName: "ws1"}},
+			workspace:    "ws1",
+			port:         "2",
+			want:         2,
+		},
+		{
+			name:         "explicit port reserved by another workspace",
+			reservations: []PortReservation{{Port: 1, WorkspaceName: "other"}},
+			workspace:    "ws1",
+			port:         "1",
+			err:          ErrPortInUse,
+		},
+		{
+			name:         "explicit port of a deleted workspace taken over",
+			reservations: []PortReservation{{Port: 1, WorkspaceName: "deleted", ReservedAt: old}},
+			workspace:    "ws1",
+			port:         "1",
+			want:         1,
+		},
+		{
+			name:         "explicit port of a workspace being created",
+			reservations: []PortReservation{{Port: 1, WorkspaceName: "pending", ReservedAt: time.Now()}},
+			workspace:    "ws1",
+			port:         "1",
+			err:          ErrPortInUse,
+		},
+		{
+			name:         "no free port in the range",
+			reservations: []PortReservation{{Port: 0, WorkspaceName: "a"}, {Port: 1, WorkspaceName: "b"}, {Port: 2, WorkspaceName: "c"}},
+			workspace:    "ws1",
+			err:          ErrNoFreePort,
+		},
+		{
+			name:      "invalid port",
+			workspace: "ws1",
+			port:      "http",
+			err:       ErrInvalidPort,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			projects := t.TempDir()
+			engine := NewEngine(WithPortsFile(filepath.Join(t.TempDir(), "ports.json")), WithPortRange(start, start+2))
+			reservations := []PortReservation{}
+			for _, reservation := range test.reservations {
+				reservation.Port += start
+				reservation.ProjectsDirectory = projects
+				if reservation.WorkspaceName != "deleted" && reservation.WorkspaceName != "pending" {
+					if err := os.Mkdir(filepath.Join(projects, reservation.WorkspaceName), 0755); err != nil {
+						t.Fatal(err)
+					}
+				}
+				reservations = append(reservations, reservation)
+			}
+			if err := engine.writePorts(reservations); err != nil {
+				t.Fatal(err)
+			}
+
+			port := test.port
+			if number, err := strconv.Atoi(port); err == nil {
+				port = strconv.Itoa(start + number)
+			}
+			got, err := engine.reservePort(projects, test.workspace, port)
+			if test.err != nil {
+				if !errors.Is(err, test.err) {
+					t.Fatalf("reservePort = %q, %v, want %v", got, err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("reservePort: %v", err)
+			}
+			if want := strconv.Itoa(start + test.want); got != want {
+				t.Fatalf("reservePort = %s, want %s", got, want)
+			}
+
+			// the table holds the reservation of the workspace, once
+			stored, err := engine.Ports()
+			if err != nil {
+				t.Fatal(err)
+			}
+			held := 0
+			for _, reservation := range stored {
+				if reservation.holds(projects, test.workspace) {
+					held++
+					if strconv.Itoa(reservation.Port) != got || reservation.ReservedAt.IsZero() {
+						t.Errorf("reservation = %+v, want port %s with its date", reservation, got)
+					}
+				}
+			}
+			if held != 1 {
+				t.Errorf("%d reservations of %s in %+v, want 1", held, test.workspace, stored)
+			}
+		})
+	}
+}
+
+func TestReservePortUsedByAProcess(t *testing.T) {
+	listener, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Skip(err)
+	}
+	defer listener.Close()
+	port := listener.Addr().(*net.TCPAddr).Port
+
+	engine := NewEngine(WithPortsFile(filepath.Join(t.TempDir(), "ports.json")))
+	_, err = engine.reservePort(t.TempDir(), "ws1", strconv.Itoa(port))
+	var conflict *PortConflictError
+	if !errors.As(err, &conflict) || conflict.Holder != nil || conflict.Port != port {
+		t.Errorf("reservePort(%d) = %v, want a conflict with a process of the host", port, err)
+	}
+}
+
+func TestReleasePort(t *testing.T) {
+	projects := t.TempDir()
+	engine := NewEngine(WithPortsFile(filepath.Join(t.TempDir(), "ports.json")))
+	if err := engine.writePorts([]PortReservation{
+		{Port: 8100, WorkspaceName: "ws1", ProjectsDirectory: projects},
+		{Port: 8101, WorkspaceName: "ws2", ProjectsDirectory: projects},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := engine.releasePort(projects, "ws1"); err != nil {
+		t.Fatalf("releasePort: %v", err)
+	}
+	reservations, err := engine.Ports()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reservations) != 1 || reservations[0].WorkspaceName != "ws2" {
+		t.Errorf("reservations = %+v, want only the one of ws2", reservations)
+	}
+}
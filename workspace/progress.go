@@ -0,0 +1,160 @@
+package workspace
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+type LogLevel string
+
+const (
+	LogInfo  LogLevel = "info"
+	LogError LogLevel = "error"
+)
+
+// Reporter receives the progress of an operation while it runs:
+// the steps as they start and end, and the output of the commands line by line.
+// It is given to the operations through their context (see WithReporter).
+type Reporter interface {
+	// Progress reports the work done: progress increases up to total (the number of steps).
+	Progress(progress, total float64, message string)
+	// Log reports a line of output of the step, or the error of a failed step.
+	Log(level LogLevel, step, line string)
+}
+
+type reporterKey struct{}
+
+// WithReporter returns a context reporting the progress of the operations run with it.
+func WithReporter(ctx context.Context, reporter Reporter) context.Context {
+	return context.WithValue(ctx, reporterKey{}, reporter)
+}
+
+// tracker follows the steps of an operation for its reporter.
+type tracker struct {
+	reporter Reporter
+	action   string
+	total    float64
+
+	mutex    sync.Mutex
+	step     string
+	done     int     // number of finished steps
+	progress float64 // last reported progress, it never decreases
+}
+
+type trackerKey struct{}
+
+// newResult creates the result of an operation of total steps.
+// When the context has a reporter, the returned context reports the output of the commands.
+func newResult(ctx context.Context, action, workspaceName string, total int) (*Result, context.Context) {
+	result := &Result{Action: action, Workspace: workspaceName, ctx: ctx}
+	reporter, ok := ctx.Value(reporterKey{}).(Reporter)
+	if !ok || reporter == nil {
+		return result, ctx
+	}
+	result.tracker = &tracker{reporter: reporter, action: action, total: float64(total), progress: -1}
+	return result, context.WithValue(ctx, trackerKey{}, result.tracker)
+}
+
+func trackerFrom(ctx context.Context) *tracker {
+	t, _ := ctx.Value(trackerKey{}).(*tracker)
+	return t
+}
+
+// report sends a progress to the reporter if it is greater than the last one
+// (the progress of MCP must increase with each notification). The caller holds the mutex.
+func (t *tracker) report(progress float64, message string) {
+	if progress <= t.progress {
+		return
+	}
+	// a step can be added on the way (e.g. the deferred clone)
+	if progress > t.total {
+		t.total = progress
+	}
+	t.progress = progress
+	t.reporter.Progress(progress, t.total, message)
+}
+
+func (t *tracker) start(step string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.step = step
+	t.report(float64(t.done), fmt.Sprintf("%s: %s", t.action, step))
+}
+
+func (t *tracker) end(step Step) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if step.Status != StepDone {
+		t.reporter.Log(LogError, step.Name, step.Message)
+		return
+	}
+	t.done++
+	t.report(float64(t.done), fmt.Sprintf("%s: %s", t.action, step.Message))
+}
+
+// buildStepPattern matches the steps of a BuildKit build, e.g. "#8 [web-ide 3/7] RUN apt-get update".
+var buildStepPattern = regexp.MustCompile(`^#\d+ \[(?:[\w.-]+ )?(\d+)/(\d+)\] (.*)$`)
+
+// line reports a line of output of the current step.
+// The build steps move the progress forward within the step.
+func (t *tracker) line(line string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	level := LogInfo
+	if strings.HasPrefix(line, "ERROR") || strings.Contains(line, "failed to solve") {
+		level = LogError
+	}
+	t.reporter.Log(level, t.step, line)
+
+	if match := buildStepPattern.FindStringSubmatch(line); match != nil {
+		current, _ := strconv.Atoi(match[1])
+		total, _ := strconv.Atoi(match[2])
+		if total > 0 && current <= total {
+			// the last build step does not complete the step: the containers still have to start
+			progress := float64(t.done) + float64(current-1)/float64(total)
+			t.report(progress, fmt.Sprintf("%s: build step %d/%d %s", t.action, current, total, match[3]))
+		}
+	}
+}
+
+// lineWriter calls fn for each line written into it, and keeps the whole output.
+type lineWriter struct {
+	output  strings.Builder
+	pending strings.Builder
+	fn      func(line string)
+	mutex   sync.Mutex
+}
+
+func (w *lineWriter) Write(data []byte) (int, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.output.Write(data)
+	for _, b := range data {
+		// the progress of docker is rewritten with \r
+		if b == '\n' || b == '\r' {
+			w.flush()
+			continue
+		}
+		w.pending.WriteByte(b)
+	}
+	return len(data), nil
+}
+
+// flush sends the pending line, if any. The caller holds the mutex.
+func (w *lineWriter) flush() {
+	if line := strings.TrimSpace(w.pending.String()); line != "" {
+		w.fn(line)
+	}
+	w.pending.Reset()
+}
+
+func (w *lineWriter) String() string {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.flush()
+	return w.output.String()
+}
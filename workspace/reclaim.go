@@ -0,0 +1,149 @@
+package workspace
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// RemoveReport is what the remove of a workspace reclaimed.
+type RemoveReport struct {
+	Containers []string `json:"containers"`
+	Networks   []string `json:"networks"`
+	Volumes    []string `json:"volumes"`
+	Images     []string `json:"images"`      // with RemoveOptions.RemoveImage
+	ImagesSize int64    `json:"images_size"` // bytes of the removed images
+	FilesSize  int64    `json:"files_size"`  // bytes of the workspace directory
+	// KeptInTrash is set when the workspace was moved to the trash: its volumes, images
+	// and files are only reclaimed when it is purged
+	KeptInTrash bool `json:"kept_in_trash,omitempty"`
+}
+
+// parseComposeDown reads the resources removed by docker compose down from its output:
+//
+//	Container ws1-web-ide-1  Removed
+//	✔ Volume ws1_data        Removed
+//
+// imageSizes gives the size of the images, by name.
+func (r *RemoveReport) parseComposeDown(output string, imageSizes map[string]int64) {
+	for line := range strings.Lines(output) {
+		fields := strings.Fields(line)
+		for i := 0; i+2 < len(fields); i++ {
+			if fields[i+2] != "Removed" {
+				continue
+			}
+			name := fields[i+1]
+			switch fields[i] {
+			case "Container":
+				r.Containers = append(r.Containers, name)
+			case "Network":
+				r.Networks = append(r.Networks, name)
+			case "Volume":
+				r.Volumes = append(r.Volumes, name)
+			case "Image":
+				r.Images = append(r.Images, name)
+				r.ImagesSize += imageSizes[imageName(name)]
+			}
+			break
+		}
+	}
+}
+
+// composeImageSizes returns the size of the images of a compose project, by name.
+// composeArgs is the docker compose command of the project. The images not built yet are missing.
+func (e *Engine) composeImageSizes(ctx context.Context, dir string, composeArgs []string) map[string]int64 {
+	sizes := map[string]int64{}
+	output, err := e.run(ctx, dir, nil, "docker", append(composeArgs, "config", "--images")...)
+	if err != nil {
+		return sizes
+	}
+	images := strings.Fields(output)
+	if len(images) == 0 {
+		return sizes
+	}
+	// docker image inspect fails when an image is missing, but prints the others
+	output, _ = e.run(ctx, dir, nil, "docker", append([]string{"image", "inspect", "--format", "{{index .RepoTags 0}} {{.Size}}"}, images...)...)
+	for line := range strings.Lines(output) {
+		name, size, found := strings.Cut(strings.TrimSpace(line), " ")
+		if !found {
+			continue
+		}
+		if bytes, err := strconv.ParseInt(size, 10, 64); err == nil {
+			sizes[imageName(name)] = bytes
+		}
+	}
+	return sizes
+}
+
+// imageName returns the name of an image without the default tag.
+func imageName(name string) string {
+	return strings.TrimSuffix(name, ":latest")
+}
+
+// directorySize returns the bytes of the files of a directory.
+func directorySize(dir string) int64 {
+	var size int64
+	filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if entry.Type().IsRegular() {
+			if info, err := entry.Info(); err == nil {
+				size += info.Size()
+			}
+		}
+		return nil
+	})
+	return size
+}
+
+// formatSize renders bytes with a binary unit: 512 B, 1.5 KiB, 2.3 GiB.
+func formatSize(bytes int64) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%d B", bytes)
+	}
+	div, exp := int64(unit), 0
+	for n := bytes / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(bytes)/float64(div), "KMGTPE"[exp])
+}
+
+// summary counts the removed resources.
+func (r *RemoveReport) summary() string {
+	return fmt.Sprintf("%d container(s), %d network(s), %d volume(s), %d image(s)",
+		len(r.Containers), len(r.Networks), len(r.Volumes), len(r.Images))
+}
+
+// String renders the report as a human readable summary.
+func (r *RemoveReport) String() string {
+	var builder strings.Builder
+	builder.WriteString("Reclaimed:\n")
+	for _, resources := range []struct {
+		kind  string
+		names []string
+	}{
+		{"Containers", r.Containers},
+		{"Networks", r.Networks},
+		{"Volumes", r.Volumes},
+		{"Images", r.Images},
+	} {
+		if len(resources.names) > 0 {
+			fmt.Fprintf(&builder, "- %s: %s\n", resources.kind, strings.Join(resources.names, ", "))
+		}
+	}
+	if len(r.Images) > 0 {
+		fmt.Fprintf(&builder, "- Images size: %s\n", formatSize(r.ImagesSize))
+	}
+	if r.KeptInTrash {
+		builder.WriteString("- Volumes, images and files: kept in the trash until it is purged\n")
+		return builder.String()
+	}
+	fmt.Fprintf(&builder, "- Files: %s\n", formatSize(r.FilesSize))
+	return builder.String()
+}
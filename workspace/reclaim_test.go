@@ -0,0 +1,87 @@
+package workspace
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseComposeDown(t *testing.T) {
+	tests := []struct {
+		name       string
+		output     string
+		imageSizes map[string]int64
+		want       RemoveReport
+	}{
+		{
+			name: "containers, volumes and networks",
+			output: ` Container ws1-web-ide-1  Stopping
+ Container ws1-web-ide-1  Stopped
+ Container ws1-web-ide-1  Removing
+ Container ws1-web-ide-1  Removed
+ ✔ Volume ws1_data  Removed
+ Network ws1_default  Removing
+ Network ws1_default  Removed
+`,
+			want: RemoveReport{
+				Containers: []string{"ws1-web-ide-1"},
+				Networks:   []string{"ws1_default"},
+				Volumes:    []string{"ws1_data"},
+			},
+		},
+		{
+			name: "images with their size",
+			output: ` ✔ Container ws1-web-ide-1  Removed  0.3s
+ ✔ Image ws1-web-ide:latest   Removed  0.1s
+ ✔ Image ws1-proxy            Removed  0.1s
+ ✔ Image ws1-unknown:v2       Removed  0.1s
+`,
+			imageSizes: map[string]int64{"ws1-web-ide": 1000, "ws1-proxy": 24},
+			want: RemoveReport{
+				Containers: []string{"ws1-web-ide-1"},
+				Images:     []string{"ws1-web-ide:latest", "ws1-proxy", "ws1-unknown:v2"},
+				ImagesSize: 1024,
+			},
+		},
+		{
+			name:   "nothing removed",
+			output: "warning: no resource found for the project\n",
+			want:   RemoveReport{},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var report RemoveReport
+			report.parseComposeDown(test.output, test.imageSizes)
+			if !slices.Equal(report.Containers, test.want.Containers) {
+				t.Errorf("Containers = %q, want %q", report.Containers, test.want.Containers)
+			}
+			if !slices.Equal(report.Networks, test.want.Networks) {
+				t.Errorf("Networks = %q, want %q", report.Networks, test.want.Networks)
+			}
+			if !slices.Equal(report.Volumes, test.want.Volumes) {
+				t.Errorf("Volumes = %q, want %q", report.Volumes, test.want.Volumes)
+			}
+			if !slices.Equal(report.Images, test.want.Images) {
+				t.Errorf("Images = %q, want %q", report.Images, test.want.Images)
+			}
+			if report.ImagesSize != test.want.ImagesSize {
+				t.Errorf("ImagesSize = %d, want %d", report.ImagesSize, test.want.ImagesSize)
+			}
+		})
+	}
+}
+
+func TestFormatSize(t *testing.T) {
+	for bytes, want := range map[int64]string{
+		0:              "0 B",
+		1023:           "1023 B",
+		1024:           "1.0 KiB",
+		1572864000:     "1.5 GiB",
+		5 * 1 << 40:    "5.0 TiB",
+		1536 * 1 << 10: "1.5 MiB",
+	} {
+		if got := formatSize(bytes); got != want {
+			t.Errorf("formatSize(%d) = %q, want %q", bytes, got, want)
+		}
+	}
+}
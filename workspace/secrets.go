@@ -0,0 +1,69 @@
+package workspace
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// readKeyPair reads an SSH key pair of the SSH directory.
+// The keys stay in memory: the caller writes them with writeSecret and clears them.
+func (e *Engine) readKeyPair(keyName string) (privateKey, publicKey []byte, err error) {
+	// a key name is a file name of the SSH directory, never a path
+	if keyName == "" || keyName != filepath.Base(keyName) || keyName == "." || keyName == ".." {
+		return nil, nil, fmt.Errorf("%w: invalid key name %q", ErrKeyNotFound, keyName)
+	}
+	privateKey, err = os.ReadFile(filepath.Join(e.SSHDirectory, keyName))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil, fmt.Errorf("%w: %s", ErrKeyNotFound, keyName)
+		}
+		return nil, nil, err
+	}
+	publicKey, err = os.ReadFile(filepath.Join(e.SSHDirectory, keyName+".pub"))
+	if err != nil {
+		clear(privateKey)
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil, fmt.Errorf("%w: %s.pub", ErrKeyNotFound, keyName)
+		}
+		return nil, nil, err
+	}
+	return privateKey, publicKey, nil
+}
+
+// writeSecret writes data to path with the 0600 mode.
+// The data goes to a temporary file of the same directory (created 0600, whatever the umask)
+// which is renamed: the secret is never readable by others, even partially written.
+func writeSecret(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".secret-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // no-op once renamed
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// removeSecrets deletes the secrets written into a workspace.
+// It is used when the creation fails: a failed workspace keeps no copy of the user's key.
+func (e *Engine) removeSecrets(projectsDirectory, workspaceName string) {
+	dir := e.Dir(projectsDirectory, workspaceName)
+	os.Remove(filepath.Join(dir, "keys", privateKeyName))
+	os.Remove(filepath.Join(dir, "workspace", ".git-credentials"))
+}
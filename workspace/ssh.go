@@ -0,0 +1,127 @@
+package workspace
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"golang.org/x/crypto/ssh"
+)
+
+var (
+	ErrInvalidSSHAuth   = errors.New("invalid ssh auth")
+	ErrSSHAgentNotFound = errors.New("ssh agent not found")
+)
+
+// SSHAuth is how the workspace authenticates to the git host with SSH.
+type SSHAuth string
+
+const (
+	// SSHAuthKey copies the user's key (key_name) into the workspace.
+	SSHAuthKey SSHAuth = "key"
+	// SSHAuthAgent forwards the SSH agent of the host into the web IDE: no key leaves the host.
+	SSHAuthAgent SSHAuth = "agent"
+	// SSHAuthDeployKey generates a key pair for the workspace only,
+	// its public key must be added as a deploy key of the repository.
+	SSHAuthDeployKey SSHAuth = "deploy_key"
+)
+
+// SSHAuths lists the supported SSH authentication modes.
+var SSHAuths = []SSHAuth{SSHAuthKey, SSHAuthAgent, SSHAuthDeployKey}
+
+// ParseSSHAuth returns the SSH authentication mode of the ssh_auth argument (key by default).
+func ParseSSHAuth(value string) (SSHAuth, error) {
+	if value == "" {
+		return SSHAuthKey, nil
+	}
+	for _, auth := range SSHAuths {
+		if SSHAuth(value) == auth {
+			return auth, nil
+		}
+	}
+	return "", fmt.Errorf("%w: %q (expected key, agent or deploy_key)", ErrInvalidSSHAuth, value)
+}
+
+// sshAgentOverrideName is the compose file mounting the SSH agent socket in the web IDE.
+// It is written into the workspaces created with the agent mode.
+const sshAgentOverrideName = "compose.ssh-agent.yml"
+
+// sshAgentSocketTarget is the path of the agent socket in the web IDE container.
+const sshAgentSocketTarget = "/run/ssh-agent.sock"
+
+// defaultSSHAgentSocket returns the agent socket to mount in the containers.
+// Docker Desktop on macOS cannot mount the launchd socket of the user and exposes the agent at a fixed path.
+func defaultSSHAgentSocket() string {
+	if runtime.GOOS == "darwin" {
+		return "/run/host-services/ssh-auth.sock"
+	}
+	return os.Getenv("SSH_AUTH_SOCK")
+}
+
+// checkSSHAgent returns ErrSSHAgentNotFound when there is no agent to forward.
+func (e *Engine) checkSSHAgent() error {
+	if e.SSHAgentSocket == "" {
+		return fmt.Errorf("%w: SSH_AUTH_SOCK is not set", ErrSSHAgentNotFound)
+	}
+	// the Docker Desktop socket only exists in its VM
+	if runtime.GOOS != "darwin" {
+		if _, err := os.Stat(e.SSHAgentSocket); err != nil {
+			return fmt.Errorf("%w: %s", ErrSSHAgentNotFound, e.SSHAgentSocket)
+		}
+	}
+	return nil
+}
+
+// sshAgentOverride returns the compose file forwarding the agent socket into the web IDE.
+func (e *Engine) sshAgentOverride() string {
+	return "services:\n" +
+		"  " + webIDEService + ":\n" +
+		"    environment:\n" +
+		"      SSH_AUTH_SOCK: " + sshAgentSocketTarget + "\n" +
+		"    volumes:\n" +
+		"      - type: bind\n" +
+		"        source: " + e.SSHAgentSocket + "\n" +
+		"        target: " + sshAgentSocketTarget + "\n"
+}
+
+// generateDeployKey generates an ed25519 key pair in the OpenSSH formats.
+// The comment identifies the workspace in the list of the deploy keys of the repository.
+func generateDeployKey(comment string) (privateKey, publicKey []byte, err error) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	block, err := ssh.MarshalPrivateKey(private, comment)
+	if err != nil {
+		return nil, nil, err
+	}
+	sshPublicKey, err := ssh.NewPublicKey(public)
+	if err != nil {
+		return nil, nil, err
+	}
+	publicKey = ssh.MarshalAuthorizedKey(sshPublicKey)
+	// MarshalAuthorizedKey ends with a new line, the comment goes before it
+	publicKey = append(publicKey[:len(publicKey)-1], []byte(" "+comment+"\n")...)
+	return pem.EncodeToMemory(block), publicKey, nil
+}
+
+// sshCommand returns the GIT_SSH_COMMAND used to clone with the SSH authentication of the workspace.
+// Only the host keys of the workspace known_hosts are accepted.
+func sshCommand(auth SSHAuth, keysDir string) (string, error) {
+	keysDir, err := filepath.Abs(keysDir)
+	if err != nil {
+		return "", err
+	}
+	hostKeyChecking := " -o UserKnownHostsFile=" + filepath.Join(keysDir, knownHostsName) + " -o StrictHostKeyChecking=yes"
+	if auth == SSHAuthAgent {
+		// the key is offered by the agent of the server (SSH_AUTH_SOCK is inherited)
+		return "ssh" + hostKeyChecking, nil
+	}
+	// clone with the key of the workspace, whatever the SSH configuration of the host
+	return "ssh -i " + filepath.Join(keysDir, privateKeyName) + " -o IdentitiesOnly=yes" + hostKeyChecking, nil
+}
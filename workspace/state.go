@@ -0,0 +1,149 @@
+package workspace
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+)
+
+type State string
+
+const (
+	StateInitializing State = "initializing" // create in progress
+	StateReady        State = "ready"        // created, never started
+	StateBuilding     State = "building"     // start in progress (docker compose up --build)
+	StateRunning      State = "running"
+	StateStopped      State = "stopped"
+	StateFailed       State = "failed" // the last operation failed, see Manifest.FailedAction
+	StateRemoving     State = "removing"
+	// StateUnknown is reported for directories without manifest
+	// (e.g. workspaces created before the manifests were introduced).
+	// No transition is enforced for them.
+	StateUnknown State = "unknown"
+)
+
+// transientStates are the states of a workspace while an operation runs.
+// The state is left unchanged while a workspace stops or its build args are updated.
+var transientStates = map[string]State{
+	"start":  StateBuilding,
+	"remove": StateRemoving,
+}
+
+// allowedStates are the states from which an operation can run.
+// A workspace whose creation failed can only be removed (see checkTransition).
+var allowedStates = map[string][]State{
+	"start":  {StateReady, StateStopped, StateRunning, StateFailed},
+	"stop":   {StateRunning, StateBuilding, StateFailed},
+	"update": {StateReady, StateStopped, StateRunning, StateFailed},
+	"remove": {StateReady, StateStopped, StateRunning, StateBuilding, StateFailed, StateRemoving},
+}
+
+// ErrInvalidTransition is wrapped by TransitionError.
+var ErrInvalidTransition = errors.New("invalid state transition")
+
+// TransitionError is returned when an operation is not allowed in the current state of a workspace.
+type TransitionError struct {
+	Workspace    string
+	Action       string
+	State        State
+	FailedAction string
+}
+
+func (e *TransitionError) Error() string {
+	if e.State == StateFailed && e.FailedAction != "" {
+		return fmt.Sprintf("cannot %s workspace %s: the last %s failed, the workspace can only be removed", e.Action, e.Workspace, e.FailedAction)
+	}
+	return fmt.Sprintf("cannot %s workspace %s in state %s (allowed: %v)", e.Action, e.Workspace, e.State, allowedStates[e.Action])
+}
+
+func (e *TransitionError) Unwrap() error {
+	return ErrInvalidTransition
+}
+
+// checkTransition returns a *TransitionError when action cannot run on the workspace.
+func checkTransition(manifest *Manifest, action string) error {
+	state := manifest.State
+	if state == StateUnknown || state == "" {
+		return nil
+	}
+	transitionError := &TransitionError{
+		Workspace:    manifest.WorkspaceName,
+		Action:       action,
+		State:        state,
+		FailedAction: manifest.FailedAction,
+	}
+	if !slices.Contains(allowedStates[action], state) {
+		return transitionError
+	}
+	// a half initialized workspace cannot be started nor stopped
+	if state == StateFailed && manifest.FailedAction == "create" && action != "remove" {
+		return transitionError
+	}
+	return nil
+}
+
+// begin checks that action can run on the workspace and records its transient state.
+// It returns a nil manifest for workspaces without manifest.
+func (e *Engine) begin(projectsDirectory, workspaceName, action string) (*Manifest, error) {
+	if err := e.exists(projectsDirectory, workspaceName); err != nil {
+		return nil, err
+	}
+	manifest, err := e.LoadManifest(projectsDirectory, workspaceName)
+	if errors.Is(err, ErrWorkspaceNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := checkTransition(manifest, action); err != nil {
+		return nil, err
+	}
+	manifest.previous = manifest.State
+	if state, ok := transientStates[action]; ok {
+		manifest.State = state
+	}
+	return manifest, e.SaveManifest(manifest)
+}
+
+// abort restores the state of a workspace whose operation stopped before doing anything.
+// It returns err, joined with the error of the manifest update if any.
+func (e *Engine) abort(manifest *Manifest, err error) error {
+	if manifest == nil || manifest.previous == "" {
+		return err
+	}
+	manifest.State = manifest.previous
+	return errors.Join(err, e.SaveManifest(manifest))
+}
+
+// finish records the outcome of action: the state becomes state on success, failed otherwise.
+// A cancelled operation, rolled back, restores the state the workspace had before it.
+// It returns err, joined with the error of the manifest update if any.
+func (e *Engine) finish(manifest *Manifest, action string, state State, err error) error {
+	if manifest == nil {
+		return err
+	}
+	now := time.Now().UTC()
+	switch {
+	case errors.Is(err, ErrCancelled):
+		if manifest.previous != "" {
+			manifest.State = manifest.previous
+		}
+		manifest.LastError = err.Error()
+	case err != nil:
+		manifest.State = StateFailed
+		manifest.FailedAction = action
+		manifest.LastError = err.Error()
+	default:
+		manifest.State = state
+		manifest.FailedAction = ""
+		manifest.LastError = ""
+		switch state {
+		case StateRunning:
+			manifest.StartedAt = &now
+		case StateStopped:
+			manifest.StoppedAt = &now
+		}
+	}
+	return errors.Join(err, e.SaveManifest(manifest))
+}
@@ -0,0 +1,69 @@
+package workspace
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCheckTransition(t *testing.T) {
+	tests := []struct {
+		state        State
+		failedAction string
+		action       string
+		allowed      bool
+	}{
+		{StateReady, "", "start", true},
+		{StateStopped, "", "start", true},
+		{StateRunning, "", "start", true},
+		{StateBuilding, "", "start", false},
+		{StateRemoving, "", "start", false},
+		{StateInitializing, "", "start", false},
+		{StateRunning, "", "stop", true},
+		{StateBuilding, "", "stop", true},
+		{StateReady, "", "stop", false},
+		{StateStopped, "", "stop", false},
+		{StateStopped, "", "remove", true},
+		{StateRemoving, "", "remove", true},
+		{StateInitializing, "", "remove", false},
+		{StateStopped, "", "update", true},
+		{StateRunning, "", "update", true},
+		{StateBuilding, "", "update", false},
+		{StateRemoving, "", "update", false},
+		{StateFailed, "start", "start", true},
+		{StateFailed, "start", "stop", true},
+		// a half initialized workspace can only be removed
+		{StateFailed, "create", "start", false},
+		{StateFailed, "create", "stop", false},
+		{StateFailed, "create", "update", false},
+		{StateFailed, "create", "remove", true},
+		// no transition is enforced without a known state
+		{StateUnknown, "", "stop", true},
+		{"", "", "start", true},
+	}
+	for _, test := range tests {
+		manifest := &Manifest{WorkspaceName: "ws1", State: test.state, FailedAction: test.failedAction}
+		err := checkTransition(manifest, test.action)
+		if test.allowed {
+			if err != nil {
+				t.Errorf("%s from %s (failed %q): %v", test.action, test.state, test.failedAction, err)
+			}
+			continue
+		}
+		var transitionError *TransitionError
+		if !errors.As(err, &transitionError) || !errors.Is(err, ErrInvalidTransition) {
+			t.Errorf("%s from %s (failed %q) = %v, want a *TransitionError", test.action, test.state, test.failedAction, err)
+			continue
+		}
+		if transitionError.Action != test.action || transitionError.State != test.state || transitionError.Workspace != "ws1" {
+			t.Errorf("%s from %s (failed %q) = %+v", test.action, test.state, test.failedAction, transitionError)
+		}
+	}
+}
+
+func TestTransitionErrorMessage(t *testing.T) {
+	err := checkTransition(&Manifest{WorkspaceName: "ws1", State: StateFailed, FailedAction: "create"}, "start")
+	want := "cannot start workspace ws1: the last create failed, the workspace can only be removed"
+	if err == nil || err.Error() != want {
+		t.Errorf("checkTransition = %v, want %q", err, want)
+	}
+}
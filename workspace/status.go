@@ -0,0 +1,259 @@
+package workspace
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// webIDEService is the compose service running the web IDE (see compose.yml).
+const webIDEService = "web-ide"
+
+// PublishedPort is a container port published on the host.
+type PublishedPort struct {
+	URL           string `json:"url,omitempty"`
+	TargetPort    int    `json:"target_port"`
+	PublishedPort int    `json:"published_port"`
+	Protocol      string `json:"protocol"`
+}
+
+// ServiceStatus is the status of the container of a compose service.
+type ServiceStatus struct {
+	Service       string          `json:"service"`
+	Container     string          `json:"container"`
+	Image         string          `json:"image"`
+	State         string          `json:"state"`            // running, exited, restarting...
+	Health        string          `json:"health,omitempty"` // healthy, unhealthy, starting, empty without healthcheck
+	Status        string          `json:"status"`           // e.g. "Up 2 hours"
+	Ports         []PublishedPort `json:"ports"`
+	StartedAt     *time.Time      `json:"started_at,omitempty"`
+	UptimeSeconds int64           `json:"uptime_seconds,omitempty"`
+}
+
+// Status is the status of a workspace: the state recorded in its manifest
+// and the actual state of its containers.
+type Status struct {
+	WorkspaceName string          `json:"workspace_name"`
+	State         State           `json:"state"`
+	Operation     string          `json:"operation,omitempty"` // operation running on the workspace (create, start...)
+	Running       bool            `json:"running"`
+	Services      []ServiceStatus `json:"services"`
+	AccessURL     string          `json:"access_url,omitempty"`
+	Error         string          `json:"error,omitempty"`
+}
+
+// composeContainer is an entry of `docker compose ps --format json`.
+type composeContainer struct {
+	ID         string
+	Name       string
+	Image      string
+	Service    string
+	State      string
+	Health     string
+	Status     string
+	Publishers []struct {
+		URL           string
+		TargetPort    int
+		PublishedPort int
+		Protocol      string
+	}
+}
+
+// parseComposePs reads the output of `docker compose ps --format json`:
+// a JSON array with old versions of Compose, one JSON object per line with the recent ones.
+func parseComposePs(output string) ([]composeContainer, error) {
+	output = strings.TrimSpace(output)
+	containers := []composeContainer{}
+	if output == "" {
+		return containers, nil
+	}
+	if strings.HasPrefix(output, "[") {
+		err := json.Unmarshal([]byte(output), &containers)
+		return containers, err
+	}
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var container composeContainer
+		if err := json.Unmarshal([]byte(line), &container); err != nil {
+			return nil, err
+		}
+		containers = append(containers, container)
+	}
+	return containers, scanner.Err()
+}
+
+// Status returns the status of a workspace and of its compose services.
+func (e *Engine) Status(ctx context.Context, projectsDirectory, workspaceName string) (*Status, error) {
+	if err := ValidateWorkspace(projectsDirectory, workspaceName); err != nil {
+		return nil, err
+	}
+	if err := e.exists(projectsDirectory, workspaceName); err != nil {
+		return nil, err
+	}
+	status := &Status{
+		WorkspaceName: workspaceName,
+		State:         StateUnknown,
+		Services:      []ServiceStatus{},
+		Operation:     e.Operation(projectsDirectory, workspaceName),
+	}
+	httpPort := ""
+	manifest, err := e.LoadManifest(projectsDirectory, workspaceName)
+	switch {
+	case err == nil:
+		status.State = manifest.State
+		httpPort = manifest.HTTPPort
+	case !errors.Is(err, ErrWorkspaceNotFound):
+		log.Printf("Using %s as the compose file of %s: %v", DefaultComposeFileName, workspaceName, err)
+	}
+
+	dir := e.Dir(projectsDirectory, workspaceName)
+	output, err := e.run(ctx, dir, nil, "docker", append(e.composeArgs(dir, manifest.composeFile()), "ps", "--all", "--format", "json")...)
+	if err != nil {
+		// the project may not exist for Docker yet (never started)
+		status.Error = strings.TrimSpace(output)
+		return status, nil
+	}
+	containers, err := parseComposePs(output)
+	if err != nil {
+		return nil, err
+	}
+
+	startedAt := e.containersStartedAt(ctx, dir, containers)
+	for _, container := range containers {
+		service := ServiceStatus{
+			Service:   container.Service,
+			Container: container.Name,
+			Image:     container.Image,
+			State:     container.State,
+			Health:    container.Health,
+			Status:    container.Status,
+			Ports:     []PublishedPort{},
+		}
+		for _, publisher := range container.Publishers {
+			if publisher.PublishedPort == 0 {
+				continue
+			}
+			service.Ports = append(service.Ports, PublishedPort{
+				URL:           publisher.URL,
+				TargetPort:    publisher.TargetPort,
+				PublishedPort: publisher.PublishedPort,
+				Protocol:      publisher.Protocol,
+			})
+			if container.Service == webIDEService {
+				httpPort = strconv.Itoa(publisher.PublishedPort)
+			}
+		}
+		if container.State == "running" {
+			status.Running = true
+			if started, ok := startedAt[container.ID]; ok {
+				service.StartedAt = &started
+				service.UptimeSeconds = int64(time.Since(started).Seconds())
+			}
+		}
+		status.Services = append(status.Services, service)
+	}
+
+	if status.Running && httpPort != "" {
+		status.AccessURL = AccessURL(httpPort, e.ProjectName(projectsDirectory, workspaceName))
+	}
+	return status, nil
+}
+
+// containersStartedAt returns the start date of the running containers, by container ID.
+func (e *Engine) containersStartedAt(ctx context.Context, dir string, containers []composeContainer) map[string]time.Time {
+	startedAt := map[string]time.Time{}
+	args := []string{"inspect", "--format", "{{.Id}} {{.State.StartedAt}}"}
+	for _, container := range containers {
+		if container.State == "running" {
+			args = append(args, container.ID)
+		}
+	}
+	if len(args) == 3 {
+		return startedAt
+	}
+	output, err := e.run(ctx, dir, nil, "docker", args...)
+	if err != nil {
+		return startedAt
+	}
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		id, date, found := strings.Cut(line, " ")
+		if !found {
+			continue
+		}
+		started, err := time.Parse(time.RFC3339Nano, date)
+		if err != nil {
+			continue
+		}
+		// compose ps returns the short ID, inspect the full one
+		for _, container := range containers {
+			if container.ID != "" && strings.HasPrefix(id, container.ID) {
+				startedAt[container.ID] = started
+			}
+		}
+	}
+	return startedAt
+}
+
+// StatusAll returns the status of all the workspaces of a projects directory.
+// The status of a workspace that cannot be read is reported with its error.
+func (e *Engine) StatusAll(ctx context.Context, projectsDirectory string) ([]Status, error) {
+	manifests, err := e.List(projectsDirectory)
+	if err != nil {
+		return nil, err
+	}
+	statuses := []Status{}
+	for _, manifest := range manifests {
+		status, err := e.Status(ctx, projectsDirectory, manifest.WorkspaceName)
+		if err != nil {
+			statuses = append(statuses, Status{
+				WorkspaceName: manifest.WorkspaceName,
+				State:         manifest.State,
+				Services:      []ServiceStatus{},
+				Error:         err.Error(),
+			})
+			continue
+		}
+		statuses = append(statuses, *status)
+	}
+	return statuses, nil
+}
+
+// String renders the status as a human readable summary.
+func (s *Status) String() string {
+	var builder strings.Builder
+	running := "not running"
+	if s.Running {
+		running = "running"
+	}
+	builder.WriteString("Workspace " + s.WorkspaceName + " (" + string(s.State) + "): " + running + "\n")
+	if s.Operation != "" {
+		builder.WriteString("Operation in progress: " + s.Operation + "\n")
+	}
+	for _, service := range s.Services {
+		builder.WriteString("- " + service.Service + " [" + service.Image + "]: " + service.Status)
+		if service.Health != "" {
+			builder.WriteString(" (" + service.Health + ")")
+		}
+		for _, port := range service.Ports {
+			builder.WriteString(" " + strconv.Itoa(port.PublishedPort) + "->" + strconv.Itoa(port.TargetPort) + "/" + port.Protocol)
+		}
+		builder.WriteString("\n")
+	}
+	if s.AccessURL != "" {
+		builder.WriteString("Access the web IDE at " + s.AccessURL + "\n")
+	}
+	if s.Error != "" {
+		builder.WriteString("Error: " + s.Error + "\n")
+	}
+	return builder.String()
+}
@@ -0,0 +1,83 @@
+package workspace
+
+import (
+	"testing"
+)
+
+func TestParseComposePs(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		want   []composeContainer
+	}{
+		{
+			name:   "no container",
+			output: "\n",
+			want:   []composeContainer{},
+		},
+		{
+			name:   "JSON array of the old versions of Compose",
+			output: `[{"Name":"ws1-web-ide-1","Service":"web-ide","State":"running"},{"Name":"ws1-db-1","Service":"db","State":"exited"}]`,
+			want: []composeContainer{
+				{Name: "ws1-web-ide-1", Service: "web-ide", State: "running"},
+				{Name: "ws1-db-1", Service: "db", State: "exited"},
+			},
+		},
+		{
+			name:   "empty JSON array",
+			output: "[]",
+			want:   []composeContainer{},
+		},
+		{
+			name: "JSON object per line",
+			output: `{"Name":"ws1-web-ide-1","Service":"web-ide","State":"running","Health":"healthy"}
+
+{"Name":"ws1-db-1","Service":"db","State":"exited"}
+`,
+			want: []composeContainer{
+				{Name: "ws1-web-ide-1", Service: "web-ide", State: "running", Health: "healthy"},
+				{Name: "ws1-db-1", Service: "db", State: "exited"},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			containers, err := parseComposePs(test.output)
+			if err != nil {
+				t.Fatalf("parseComposePs: %v", err)
+			}
+			if len(containers) != len(test.want) {
+				t.Fatalf("parseComposePs = %+v, want %+v", containers, test.want)
+			}
+			for i, container := range containers {
+				want := test.want[i]
+				if container.Name != want.Name || container.Service != want.Service || container.State != want.State || container.Health != want.Health {
+					t.Errorf("container %d = %+v, want %+v", i, container, want)
+				}
+			}
+		})
+	}
+}
+
+func TestParseComposePsPublishers(t *testing.T) {
+	output := `{"Name":"ws1-web-ide-1","Service":"web-ide","Publishers":[{"URL":"0.0.0.0","TargetPort":3000,"PublishedPort":8100,"Protocol":"tcp"}]}`
+	containers, err := parseComposePs(output)
+	if err != nil {
+		t.Fatalf("parseComposePs: %v", err)
+	}
+	if len(containers) != 1 || len(containers[0].Publishers) != 1 {
+		t.Fatalf("parseComposePs = %+v, want one container with one publisher", containers)
+	}
+	publisher := containers[0].Publishers[0]
+	if publisher.TargetPort != 3000 || publisher.PublishedPort != 8100 || publisher.Protocol != "tcp" {
+		t.Errorf("publisher = %+v, want 3000 published on 8100/tcp", publisher)
+	}
+}
+
+func TestParseComposePsErrors(t *testing.T) {
+	for _, output := range []string{`[{"Name":`, "{\"Name\":\"ws1-web-ide-1\"}\nnot json"} {
+		if containers, err := parseComposePs(output); err == nil {
+			t.Errorf("parseComposePs(%q) = %+v, want an error", output, containers)
+		}
+	}
+}
@@ -0,0 +1,385 @@
+package workspace
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+var ErrTrashEntryNotFound = errors.New("trash entry not found")
+
+// TrashDirectoryName is the directory of a projects directory holding its removed workspaces.
+// It is hidden: the lists of workspaces skip it.
+const TrashDirectoryName = ".trash"
+
+// TrashEntry is a removed workspace kept in the trash until it expires.
+// The directory of the workspace is moved to <projects_directory>/.trash/<id>,
+// its compose project keeps its volumes and images until the entry is purged.
+type TrashEntry struct {
+	ID                string    `json:"id"`
+	WorkspaceName     string    `json:"workspace_name"`
+	ProjectsDirectory string    `json:"projects_directory"` // absolute
+	State             State     `json:"state"`              // before the remove
+	HTTPPort          string    `json:"http_port,omitempty"`
+	RemoveImage       bool      `json:"remove_image,omitempty"` // the built images are removed with the entry
+	FilesSize         int64     `json:"files_size"`
+	TrashedAt         time.Time `json:"trashed_at"`
+	ExpiresAt         time.Time `json:"expires_at"`
+}
+
+func (t TrashEntry) path() string {
+	return filepath.Join(t.ProjectsDirectory, TrashDirectoryName, t.ID)
+}
+
+// Expired reports whether the entry is purged by the background purge.
+func (t TrashEntry) Expired() bool {
+	return time.Now().After(t.ExpiresAt)
+}
+
+// RestoreOptions are the parameters of the restore_workspace tool.
+type RestoreOptions struct {
+	TrashID string
+	OnBusy  OnBusy
+}
+
+// PurgeOptions are the parameters of the purge_trash tool.
+// Without TrashID, all the entries (of ProjectsDirectory if not empty) are purged.
+type PurgeOptions struct {
+	ProjectsDirectory string
+	TrashID           string
+	ExpiredOnly       bool
+	OnBusy            OnBusy // for the workspaces being restored, fail by default
+}
+
+// Trash returns the entries of the trash, of a projects directory or of all when empty,
+// the most recently removed first.
+func (e *Engine) Trash(projectsDirectory string) ([]TrashEntry, error) {
+	e.trashMutex.Lock()
+	defer e.trashMutex.Unlock()
+	entries, err := e.readTrash()
+	if err != nil {
+		return nil, err
+	}
+	if projectsDirectory == "" {
+		return entries, nil
+	}
+	kept := []TrashEntry{}
+	for _, entry := range entries {
+		if entry.ProjectsDirectory == absPath(projectsDirectory) {
+			kept = append(kept, entry)
+		}
+	}
+	return kept, nil
+}
+
+// readTrash reads the index of the trash. The caller holds the mutex.
+func (e *Engine) readTrash() ([]TrashEntry, error) {
+	entries := []TrashEntry{}
+	data, err := os.ReadFile(e.TrashFile)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return entries, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("invalid trash index %s: %w", e.TrashFile, err)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].TrashedAt.After(entries[j].TrashedAt)
+	})
+	return entries, nil
+}
+
+func (e *Engine) writeTrash(entries []TrashEntry) error {
+	if err := os.MkdirAll(filepath.Dir(e.TrashFile), 0700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := e.TrashFile + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, e.TrashFile)
+}
+
+// trashEntry returns an entry of the index.
+func (e *Engine) trashEntry(id string) (TrashEntry, error) {
+	e.trashMutex.Lock()
+	defer e.trashMutex.Unlock()
+	entries, err := e.readTrash()
+	if err != nil {
+		return TrashEntry{}, err
+	}
+	for _, entry := range entries {
+		if entry.ID == id {
+			return entry, nil
+		}
+	}
+	return TrashEntry{}, fmt.Errorf("%w: %s", ErrTrashEntryNotFound, id)
+}
+
+// updateTrash applies fn to the index.
+func (e *Engine) updateTrash(fn func(entries []TrashEntry) []TrashEntry) error {
+	e.trashMutex.Lock()
+	defer e.trashMutex.Unlock()
+	entries, err := e.readTrash()
+	if err != nil {
+		return err
+	}
+	return e.writeTrash(fn(entries))
+}
+
+func withoutTrashEntry(entries []TrashEntry, id string) []TrashEntry {
+	kept := []TrashEntry{}
+	for _, entry := range entries {
+		if entry.ID != id {
+			kept = append(kept, entry)
+		}
+	}
+	return kept
+}
+
+// moveToTrash runs the move_to_trash step of a remove: the directory of the workspace
+// is moved to the trash of its projects directory, and its HTTP port released.
+func (e *Engine) moveToTrash(result *Result, manifest *Manifest, options RemoveOptions) error {
+	return result.do("move_to_trash", func(step *Step) error {
+		dir := e.Dir(options.ProjectsDirectory, options.WorkspaceName)
+		now := time.Now().UTC()
+		entry := TrashEntry{
+			ID:                options.WorkspaceName + "-" + now.Format("20060102-150405"),
+			WorkspaceName:     options.WorkspaceName,
+			ProjectsDirectory: absPath(options.ProjectsDirectory),
+			State:             StateUnknown,
+			RemoveImage:       options.RemoveImage,
+			FilesSize:         directorySize(dir),
+			TrashedAt:         now,
+			ExpiresAt:         now.Add(e.TrashRetention),
+		}
+		if manifest != nil {
+			entry.State = manifest.previous
+			entry.HTTPPort = manifest.HTTPPort
+		}
+		if err := os.MkdirAll(filepath.Dir(entry.path()), 0700); err != nil {
+			return err
+		}
+		for suffix := 2; ; suffix++ {
+			if _, err := os.Stat(entry.path()); errors.Is(err, fs.ErrNotExist) {
+				break
+			}
+			entry.ID = fmt.Sprintf("%s-%s-%d", options.WorkspaceName, now.Format("20060102-150405"), suffix)
+		}
+		if err := os.Rename(dir, entry.path()); err != nil {
+			return err
+		}
+		err := e.updateTrash(func(entries []TrashEntry) []TrashEntry {
+			return append(entries, entry)
+		})
+		if err != nil {
+			// a workspace out of the index would never be purged
+			return errors.Join(err, os.Rename(entry.path(), dir))
+		}
+		if err := e.releasePort(options.ProjectsDirectory, options.WorkspaceName); err != nil {
+			slog.Error(fmt.Sprintf("Failed to release the port of %s: %v", options.WorkspaceName, err))
+		}
+		result.Trashed = &entry
+		step.Message = fmt.Sprintf("Workspace moved to the trash as %s, until %s", entry.ID, entry.ExpiresAt.Format(time.DateTime))
+		return nil
+	})
+}
+
+// Restore moves a workspace back from the trash to its projects directory.
+// The workspace is stopped. It gets back its HTTP port, or a new one when the port was taken meanwhile.
+func (e *Engine) Restore(ctx context.Context, options RestoreOptions) (*Result, error) {
+	result, ctx := newResult(ctx, "restore", "", 2)
+
+	var entry TrashEntry
+	unlock := func() {}
+	defer func() { unlock() }()
+	err := result.do("check_trash", func(step *Step) error {
+		if err := ValidateRestore(options); err != nil {
+			return err
+		}
+		var err error
+		entry, err = e.trashEntry(options.TrashID)
+		if err != nil {
+			return err
+		}
+		result.Workspace = entry.WorkspaceName
+		release, err := e.lock(ctx, entry.ProjectsDirectory, entry.WorkspaceName, "restore", options.OnBusy)
+		if err != nil {
+			return err
+		}
+		unlock = release
+		if _, err := os.Stat(e.Dir(entry.ProjectsDirectory, entry.WorkspaceName)); err == nil {
+			return fmt.Errorf("%w: %s, remove or rename it first", ErrWorkspaceExists, e.Dir(entry.ProjectsDirectory, entry.WorkspaceName))
+		}
+		if _, err := os.Stat(entry.path()); err != nil {
+			return fmt.Errorf("%w: %s has no directory %s", ErrTrashEntryNotFound, entry.ID, entry.path())
+		}
+		step.Message = fmt.Sprintf("Trash entry %s found", entry.ID)
+		return nil
+	})
+	if err != nil {
+		return result, err
+	}
+
+	err = result.do("restore_files", func(step *Step) error {
+		dir := e.Dir(entry.ProjectsDirectory, entry.WorkspaceName)
+		if err := os.Rename(entry.path(), dir); err != nil {
+			return err
+		}
+		if err := e.updateTrash(func(entries []TrashEntry) []TrashEntry {
+			return withoutTrashEntry(entries, entry.ID)
+		}); err != nil {
+			return errors.Join(err, os.Rename(dir, entry.path()))
+		}
+		step.Message = fmt.Sprintf("Workspace restored into %s", dir)
+
+		manifest, err := e.LoadManifest(entry.ProjectsDirectory, entry.WorkspaceName)
+		if errors.Is(err, ErrWorkspaceNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		// the manifest is saved where the workspace was restored, whatever its stored (maybe relative) directory
+		manifest.ProjectsDirectory = entry.ProjectsDirectory
+		// the containers were removed with the workspace
+		manifest.State = entry.State
+		if entry.State == StateRunning || entry.State == StateBuilding || entry.State == StateRemoving {
+			manifest.State = StateStopped
+		}
+		if manifest.HTTPPort != "" {
+			port, err := e.reservePort(entry.ProjectsDirectory, entry.WorkspaceName, manifest.HTTPPort)
+			if errors.Is(err, ErrPortInUse) {
+				port, err = e.reservePort(entry.ProjectsDirectory, entry.WorkspaceName, "")
+			}
+			if err != nil {
+				return err
+			}
+			if port != manifest.HTTPPort {
+				step.Message += fmt.Sprintf(", HTTP port %s taken meanwhile, %s reserved instead", manifest.HTTPPort, port)
+			}
+			manifest.HTTPPort = port
+			if err := os.WriteFile(filepath.Join(dir, ".env"), []byte("HTTP_PORT="+port+"\n"), 0644); err != nil {
+				return err
+			}
+		}
+		step.Message += fmt.Sprintf(", state %s", manifest.State)
+		return e.SaveManifest(manifest)
+	})
+	return result, err
+}
+
+// PurgeTrash deletes entries of the trash for good: their files, and the volumes
+// (and images, when asked at removal) of their compose project.
+// Result.Reclaimed sums what was deleted. The entries of busy workspaces fail, or wait with OnBusyWait.
+func (e *Engine) PurgeTrash(ctx context.Context, options PurgeOptions) (*Result, error) {
+	result, ctx := newResult(ctx, "purge", TrashDirectoryName, 0)
+	if err := ValidatePurge(options); err != nil {
+		return result, err
+	}
+	entries, err := e.Trash(options.ProjectsDirectory)
+	if err != nil {
+		return result, err
+	}
+	if options.TrashID != "" {
+		entry, err := e.trashEntry(options.TrashID)
+		if err != nil {
+			return result, err
+		}
+		entries = []TrashEntry{entry}
+	}
+
+	reclaimed := &RemoveReport{Containers: []string{}, Networks: []string{}, Volumes: []string{}, Images: []string{}}
+	result.Reclaimed = reclaimed
+	var errs []error
+	for _, entry := range entries {
+		if options.ExpiredOnly && !entry.Expired() {
+			continue
+		}
+		if err := e.purge(ctx, result, entry, options.OnBusy, reclaimed); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return result, errors.Join(errs...)
+}
+
+// purge runs the purge step of an entry of the trash.
+func (e *Engine) purge(ctx context.Context, result *Result, entry TrashEntry, onBusy OnBusy, reclaimed *RemoveReport) error {
+	return result.do("purge", func(step *Step) error {
+		release, err := e.lock(ctx, entry.ProjectsDirectory, entry.WorkspaceName, "purge", onBusy)
+		if err != nil {
+			return err
+		}
+		defer release()
+		dir := entry.path()
+		// the manifest moved to the trash with the workspace
+		composeFile := e.composeFileName(filepath.Dir(dir), entry.ID)
+		var messages []string
+		_, composeErr := os.Stat(filepath.Join(dir, composeFile))
+		_, existsErr := os.Stat(e.Dir(entry.ProjectsDirectory, entry.WorkspaceName))
+		switch {
+		case composeErr != nil:
+		case existsErr == nil:
+			// the compose project has the name of the workspace: a new workspace with this name uses it
+			messages = append(messages, fmt.Sprintf("volumes kept, used by the new workspace %s", entry.WorkspaceName))
+		default:
+			composeArgs := append(e.composeArgs(dir, composeFile), "-p", composeProjectName(entry.WorkspaceName))
+			args := append(slices.Clone(composeArgs), "down", "--volumes", "--remove-orphans")
+			imageSizes := map[string]int64{}
+			if entry.RemoveImage {
+				imageSizes = e.composeImageSizes(ctx, dir, composeArgs)
+				args = append(args, "--rmi", "local")
+			}
+			output, err := e.run(ctx, dir, nil, "docker", args...)
+			step.Output = output
+			if err != nil {
+				step.Message = fmt.Sprintf("%s: failed to remove the volumes of workspace %s", entry.ID, entry.WorkspaceName)
+				return err
+			}
+			reclaimed.parseComposeDown(output, imageSizes)
+		}
+		size := directorySize(dir)
+		if err := os.RemoveAll(dir); err != nil {
+			return err
+		}
+		reclaimed.FilesSize += size
+		if err := e.updateTrash(func(entries []TrashEntry) []TrashEntry {
+			return withoutTrashEntry(entries, entry.ID)
+		}); err != nil {
+			return err
+		}
+		messages = append([]string{fmt.Sprintf("%s: workspace %s of %s purged (%s)", entry.ID, entry.WorkspaceName, entry.ProjectsDirectory, formatSize(size))}, messages...)
+		step.Message = strings.Join(messages, ", ")
+		return nil
+	})
+}
+
+// composeProjectName returns the Docker Compose project name of a workspace,
+// the name of its directory normalized by Docker Compose. It is given to the
+// commands run in the trash, where the directory has another name.
+func composeProjectName(workspaceName string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '_', r == '-':
+			return r
+		default:
+			return -1
+		}
+	}, strings.ToLower(workspaceName))
+	return strings.TrimLeft(name, "_-")
+}
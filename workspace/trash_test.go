@@ -0,0 +1,54 @@
+package workspace
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// A restored workspace gets its manifest back in the projects directory of the trash entry,
+// whatever the directory stored in the manifest: a relative one would depend on the working directory.
+func TestRestoreManifest(t *testing.T) {
+	projects := t.TempDir()
+	engine := NewEngine(WithTrashFile(filepath.Join(t.TempDir(), "trash.json")))
+	entry := TrashEntry{
+		ID:                "ws1-20260101-120000",
+		WorkspaceName:     "ws1",
+		ProjectsDirectory: projects,
+		State:             StateRunning,
+		TrashedAt:         time.Now().UTC(),
+		ExpiresAt:         time.Now().UTC().Add(time.Hour),
+	}
+	if err := os.MkdirAll(entry.path(), 0755); err != nil {
+		t.Fatal(err)
+	}
+	manifest := &Manifest{WorkspaceName: "ws1", ProjectsDirectory: "relative/projects", State: StateRemoving}
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(entry.path(), ManifestFileName), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := engine.writeTrash([]TrashEntry{entry}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := engine.Restore(context.Background(), RestoreOptions{TrashID: entry.ID}); err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	restored, err := engine.LoadManifest(projects, "ws1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restored.ProjectsDirectory != projects || restored.State != StateStopped {
+		t.Errorf("restored manifest = %+v, want the projects directory %s and the state %s", restored, projects, StateStopped)
+	}
+	entries, err := engine.Trash("")
+	if err != nil || len(entries) != 0 {
+		t.Errorf("Trash = %+v, %v, want no entry", entries, err)
+	}
+}
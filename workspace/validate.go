@@ -0,0 +1,364 @@
+package workspace
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+var ErrInvalidArgument = errors.New("invalid argument")
+
+// FieldError is an invalid argument of a tool.
+type FieldError struct {
+	Field   string `json:"field"` // the name of the argument, e.g. workspace_name
+	Message string `json:"message"`
+}
+
+// ValidationError lists the invalid arguments of an operation.
+// It is returned before the operation touches the file system or runs a command.
+type ValidationError struct {
+	Fields []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	fields := make([]string, 0, len(e.Fields))
+	for _, field := range e.Fields {
+		fields = append(fields, field.Field+" "+field.Message)
+	}
+	return fmt.Sprintf("%v: %s", ErrInvalidArgument, strings.Join(fields, "; "))
+}
+
+func (e *ValidationError) Unwrap() error {
+	return ErrInvalidArgument
+}
+
+var (
+	// a workspace name is a directory of the projects directory and the Docker Compose project name
+	workspaceNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]{0,62}$`)
+	// the user and the host of a remote are arguments of ssh: they never start with "-"
+	remoteHostPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9.-]*$`)
+	remoteUserPattern = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]*$`)
+	emailPattern      = regexp.MustCompile(`^[^@\s]+@[^@\s]+$`)
+	// a trash id is <workspace_name>-<date>-<time>[-<n>], a directory of the trash
+	trashIDPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]{0,99}$`)
+)
+
+// validation collects the invalid arguments of an operation.
+type validation struct {
+	fields []FieldError
+}
+
+func (v *validation) add(field, format string, args ...any) {
+	v.fields = append(v.fields, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// err returns a *ValidationError when an argument is invalid, nil otherwise.
+func (v *validation) err() error {
+	if len(v.fields) == 0 {
+		return nil
+	}
+	return &ValidationError{Fields: v.fields}
+}
+
+func (v *validation) required(field, value string) bool {
+	if value == "" {
+		v.add(field, "is required")
+		return false
+	}
+	return true
+}
+
+// text checks a value written into a file of the workspace (.gitconfig, credentials):
+// a line break would add entries to the file.
+func (v *validation) text(field, value string) bool {
+	if strings.ContainsFunc(value, unicode.IsControl) {
+		v.add(field, "must not contain control characters")
+		return false
+	}
+	return true
+}
+
+func (v *validation) workspaceName(name string) {
+	if v.required("workspace_name", name) && !workspaceNamePattern.MatchString(name) {
+		v.add("workspace_name", "must have 1 to 63 letters, digits, '.', '_' or '-', and start with a letter or a digit")
+	}
+}
+
+// projectsDirectory rejects the paths going up with "..": the workspaces are
+// created and deleted in the projects directory, never beside it.
+func (v *validation) projectsDirectory(directory string) {
+	if !v.required("projects_directory", directory) || !v.text("projects_directory", directory) {
+		return
+	}
+	if slices.Contains(strings.Split(filepath.ToSlash(directory), "/"), "..") {
+		v.add("projects_directory", "must not contain '..'")
+		return
+	}
+	clean := filepath.Clean(directory)
+	if clean == filepath.VolumeName(clean)+string(filepath.Separator) {
+		v.add("projects_directory", "must not be the root directory")
+	}
+}
+
+// fileName checks the name of a file of a directory of the server (templates, SSH keys).
+func (v *validation) fileName(field, name string) bool {
+	if name != filepath.Base(name) || strings.ContainsAny(name, `/\`) || strings.HasPrefix(name, ".") || !v.text(field, name) {
+		v.add(field, "must be a file name, not a path")
+		return false
+	}
+	return true
+}
+
+func (v *validation) port(field, port string) {
+	if port == "" {
+		return
+	}
+	if number, err := strconv.Atoi(port); err != nil || number < 1 || number > 65535 {
+		v.add(field, "must be a number between 1 and 65535")
+	}
+}
+
+func (v *validation) onBusy(onBusy OnBusy) {
+	if onBusy != "" && onBusy != OnBusyFail && onBusy != OnBusyWait {
+		v.add("on_busy", "must be %s or %s", OnBusyFail, OnBusyWait)
+	}
+}
+
+// remote checks the repository and the git host, and returns the remote to clone.
+func (v *validation) remote(gitHost, repository string) *Remote {
+	if !v.required("repository", repository) || !v.text("repository", repository) || !v.text("git_host", gitHost) {
+		return nil
+	}
+	remote, err := ParseRemote(gitHost, repository)
+	if err != nil {
+		v.add("repository", "%s", strings.TrimPrefix(err.Error(), ErrInvalidRepository.Error()+": "))
+		return nil
+	}
+	field := "repository"
+	if gitHost != "" && !strings.Contains(repository, ":") {
+		field = "git_host"
+	}
+	switch {
+	case !remoteHostPattern.MatchString(remote.Host):
+		v.add(field, "has an invalid host %q", remote.Host)
+	case remote.User != "" && !remoteUserPattern.MatchString(remote.User):
+		v.add(field, "has an invalid user %q", remote.User)
+	case remote.Port != "" && !validPort(remote.Port):
+		v.add(field, "has an invalid port %q", remote.Port)
+	case slices.Contains(strings.Split(remote.Path, "/"), ".."), strings.HasPrefix(remote.Path, "-"):
+		v.add("repository", "has an invalid path %q", remote.Path)
+	default:
+		return remote
+	}
+	return nil
+}
+
+// template checks that a template of the templates directory exists, with one of the extensions.
+func (v *validation) template(field, name string, templates []string, extensions ...string) {
+	if !v.required(field, name) || !v.fileName(field, name) {
+		return
+	}
+	if !slices.ContainsFunc(extensions, func(extension string) bool { return strings.HasSuffix(name, extension) }) {
+		v.add(field, "must be a %s template", strings.Join(extensions, " or "))
+		return
+	}
+	if !slices.Contains(templates, name) {
+		v.add(field, "is not a template: %s (see get_dockerfiles_list)", name)
+	}
+}
+
+func validPort(port string) bool {
+	number, err := strconv.Atoi(port)
+	return err == nil && number >= 1 && number <= 65535
+}
+
+// ValidateProjectsDirectory checks the projects_directory argument of a tool.
+func ValidateProjectsDirectory(projectsDirectory string) error {
+	var v validation
+	v.projectsDirectory(projectsDirectory)
+	return v.err()
+}
+
+// ValidateWorkspace checks the projects_directory and workspace_name arguments of a tool.
+func ValidateWorkspace(projectsDirectory, workspaceName string) error {
+	var v validation
+	v.projectsDirectory(projectsDirectory)
+	v.workspaceName(workspaceName)
+	return v.err()
+}
+
+// ValidateCreate checks the arguments of the initializer_workspace tool,
+// the templates against the templates directory.
+func (e *Engine) ValidateCreate(options CreateOptions) error {
+	options.applyDefaults()
+	var v validation
+	v.projectsDirectory(options.ProjectsDirectory)
+	v.workspaceName(options.WorkspaceName)
+	v.remote(options.GitHost, options.Repository)
+	if v.required("git_user_name", options.GitUserName) {
+		v.text("git_user_name", options.GitUserName)
+	}
+	if v.required("git_user_email", options.GitUserEmail) && v.text("git_user_email", options.GitUserEmail) &&
+		!emailPattern.MatchString(options.GitUserEmail) {
+		v.add("git_user_email", "must be an email address")
+	}
+	v.text("git_token", options.GitToken)
+	if options.KeyName != "" {
+		v.fileName("key_name", options.KeyName)
+	}
+	if options.SSHAuth != "" {
+		if _, err := ParseSSHAuth(string(options.SSHAuth)); err != nil {
+			v.add("ssh_auth", "must be %s, %s or %s", SSHAuthKey, SSHAuthAgent, SSHAuthDeployKey)
+		}
+	}
+	templates, err := e.Templates()
+	if err != nil {
+		return err
+	}
+	v.template("dockerfile_name", options.DockerfileName, templates, ".Dockerfile")
+	if len(options.BuildArgs) > 0 && strings.HasSuffix(options.DockerfileName, ".Dockerfile") && slices.Contains(templates, options.DockerfileName) {
+		content, err := e.readTemplate(options.DockerfileName)
+		if err != nil {
+			return err
+		}
+		v.buildArgs(options.BuildArgs, declaredBuildArgs(content), options.DockerfileName, false)
+	}
+	v.template("compose_file_name", options.ComposeFileName, templates, ".yml", ".yaml")
+	// an override (e.g. compose.offload.yml) cannot be the compose file of a workspace
+	if isCompose := strings.HasSuffix(options.ComposeFileName, ".yml") || strings.HasSuffix(options.ComposeFileName, ".yaml"); isCompose && slices.Contains(templates, options.ComposeFileName) {
+		if content, err := e.readTemplate(options.ComposeFileName); err == nil && !isBaseComposeFile(content) {
+			v.add("compose_file_name", "is an override, not a compose file defining the build of the %s service", webIDEService)
+		}
+	}
+	v.template("offload_override_name", options.OffloadOverrideName, templates, ".yml", ".yaml")
+	v.port("http_port", options.HTTPPort)
+	v.onBusy(options.OnBusy)
+	return v.err()
+}
+
+// ValidateStart checks the arguments of the start_workspace tool.
+func ValidateStart(options StartOptions) error {
+	var v validation
+	v.projectsDirectory(options.ProjectsDirectory)
+	v.workspaceName(options.WorkspaceName)
+	v.port("http_port", options.HTTPPort)
+	v.onBusy(options.OnBusy)
+	return v.err()
+}
+
+// ValidateUpdate checks the arguments of the update_workspace tool,
+// the build args against the ARGs of the Dockerfile of the workspace.
+func (e *Engine) ValidateUpdate(options UpdateOptions) error {
+	var v validation
+	v.projectsDirectory(options.ProjectsDirectory)
+	v.workspaceName(options.WorkspaceName)
+	if len(options.BuildArgs) == 0 {
+		v.add("build_args", "is required")
+	}
+	v.onBusy(options.OnBusy)
+	if err := v.err(); err != nil {
+		return err
+	}
+	// the Dockerfile of the workspace, not its template: the template may have changed since
+	content, err := os.ReadFile(filepath.Join(e.Dir(options.ProjectsDirectory, options.WorkspaceName), "Dockerfile"))
+	if errors.Is(err, fs.ErrNotExist) && e.exists(options.ProjectsDirectory, options.WorkspaceName) != nil {
+		// reported by Update
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	v.buildArgs(options.BuildArgs, declaredBuildArgs(content), "the Dockerfile of "+options.WorkspaceName, true)
+	return v.err()
+}
+
+// ValidateStop checks the arguments of the stop_workspace tool.
+func ValidateStop(options StopOptions) error {
+	var v validation
+	v.projectsDirectory(options.ProjectsDirectory)
+	v.workspaceName(options.WorkspaceName)
+	v.onBusy(options.OnBusy)
+	return v.err()
+}
+
+// ValidateRemove checks the arguments of the remove_workspace tool.
+func ValidateRemove(options RemoveOptions) error {
+	var v validation
+	v.projectsDirectory(options.ProjectsDirectory)
+	v.workspaceName(options.WorkspaceName)
+	v.onBusy(options.OnBusy)
+	return v.err()
+}
+
+// ValidateRestore checks the arguments of the restore_workspace tool.
+func ValidateRestore(options RestoreOptions) error {
+	var v validation
+	if v.required("trash_id", options.TrashID) && !trashIDPattern.MatchString(options.TrashID) {
+		v.add("trash_id", "is not a trash id (see list_trashed_workspaces)")
+	}
+	v.onBusy(options.OnBusy)
+	return v.err()
+}
+
+// ValidatePurge checks the arguments of the purge_trash tool.
+func ValidatePurge(options PurgeOptions) error {
+	var v validation
+	if options.ProjectsDirectory != "" {
+		v.projectsDirectory(options.ProjectsDirectory)
+	}
+	if options.TrashID != "" && !trashIDPattern.MatchString(options.TrashID) {
+		v.add("trash_id", "is not a trash id (see list_trashed_workspaces)")
+	}
+	v.onBusy(options.OnBusy)
+	return v.err()
+}
+
+// ValidateKnownHost checks the arguments of the add_known_host tool.
+func ValidateKnownHost(host, port string) error {
+	var v validation
+	if v.required("host", host) && !remoteHostPattern.MatchString(host) {
+		v.add("host", "must be a host name or an IPv4 address, starting with a letter or a digit")
+	}
+	v.port("port", port)
+	return v.err()
+}
+
+// ValidateDefaults checks the default values of the arguments of the tools, by argument name:
+// the defaults of the server and the ones set for a session with the set_defaults tool.
+// The empty values are not checked, they unset a default.
+func ValidateDefaults(defaults map[string]string) error {
+	var v validation
+	for _, field := range slices.Sorted(maps.Keys(defaults)) {
+		value := defaults[field]
+		if value == "" {
+			continue
+		}
+		switch field {
+		case "projects_directory":
+			v.projectsDirectory(value)
+		case "git_user_name", "git_host":
+			v.text(field, value)
+		case "git_user_email":
+			if v.text(field, value) && !emailPattern.MatchString(value) {
+				v.add(field, "must be an email address")
+			}
+		case "key_name":
+			v.fileName(field, value)
+		case "ssh_auth":
+			if _, err := ParseSSHAuth(value); err != nil {
+				v.add(field, "must be %s, %s or %s", SSHAuthKey, SSHAuthAgent, SSHAuthDeployKey)
+			}
+		default:
+			v.add(field, "has no default")
+		}
+	}
+	return v.err()
+}
@@ -0,0 +1,200 @@
+package workspace
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// invalidFields returns the fields of a *ValidationError, nil when err is nil.
+func invalidFields(t *testing.T, err error) []string {
+	t.Helper()
+	if err == nil {
+		return nil
+	}
+	var validationError *ValidationError
+	if !errors.As(err, &validationError) || !errors.Is(err, ErrInvalidArgument) {
+		t.Fatalf("error = %v, want a *ValidationError", err)
+	}
+	var fields []string
+	for _, field := range validationError.Fields {
+		if field.Message == "" {
+			t.Errorf("%s has no message", field.Field)
+		}
+		fields = append(fields, field.Field)
+	}
+	return fields
+}
+
+func TestValidateCreate(t *testing.T) {
+	templates := t.TempDir()
+	for name, content := range map[string]string{
+		"golang.Dockerfile":   "FROM scratch\nARG TARGETARCH\nARG GO_VERSION=1.24.4\n",
+		"plain.Dockerfile":    "FROM scratch\n",
+		"compose.yml":         "services:\n  web-ide:\n    build: .\n",
+		"compose.offload.yml": "models:\n  llm:\n    model: ai/qwen3\n",
+	} {
+		if err := os.WriteFile(filepath.Join(templates, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	engine := NewEngine(WithTemplatesDirectory(templates))
+
+	valid := CreateOptions{
+		GitUserEmail:        "bob@example.com",
+		GitUserName:         "Bob",
+		GitHost:             "github.com",
+		Repository:          "k33g/compose-codex.git",
+		WorkspaceName:       "ws1",
+		ProjectsDirectory:   "projects",
+		DockerfileName:      "golang.Dockerfile",
+		ComposeFileName:     "compose.yml",
+		OffloadOverrideName: "compose.offload.yml",
+	}
+	tests := []struct {
+		name   string
+		change func(options *CreateOptions)
+		fields []string // the invalid fields, in order
+	}{
+		{"valid", func(options *CreateOptions) {}, nil},
+		{"valid with a port and a clone URL", func(options *CreateOptions) {
+			options.HTTPPort = "8100"
+			options.Repository = "ssh://git@gitlab.example.com:2222/team/project.git"
+		}, nil},
+		{"invalid names", func(options *CreateOptions) {
+			options.ProjectsDirectory = "../projects"
+			options.WorkspaceName = "-ws1"
+			options.KeyName = "../id_ed25519"
+			options.SSHAuth = "password"
+		}, []string{"projects_directory", "workspace_name", "key_name", "ssh_auth"}},
+		{"invalid git user", func(options *CreateOptions) {
+			options.GitUserName = "Bob\n[core]"
+			options.GitUserEmail = "bob"
+			options.GitToken = "token\n"
+		}, []string{"git_user_name", "git_user_email", "git_token"}},
+		{"missing git user", func(options *CreateOptions) {
+			options.GitUserName = ""
+			options.GitUserEmail = ""
+		}, []string{"git_user_name", "git_user_email"}},
+		{"invalid git host", func(options *CreateOptions) {
+			options.GitHost = "-oProxyCommand=x"
+		}, []string{"git_host"}},
+		{"invalid repository path", func(options *CreateOptions) {
+			options.Repository = "git@github.com:team/../../etc.git"
+		}, []string{"repository"}},
+		{"invalid templates", func(options *CreateOptions) {
+			options.DockerfileName = "rust.Dockerfile"
+			options.ComposeFileName = "compose.json"
+			options.OffloadOverrideName = "../compose.offload.yml"
+		}, []string{"dockerfile_name", "compose_file_name", "offload_override_name"}},
+		{"defaults of the optional templates", func(options *CreateOptions) {
+			options.GitHost = ""
+			options.ComposeFileName = ""
+			options.OffloadOverrideName = ""
+		}, nil},
+		{"override as compose file", func(options *CreateOptions) {
+			options.ComposeFileName = "compose.offload.yml"
+		}, []string{"compose_file_name"}},
+		{"build args", func(options *CreateOptions) {
+			options.BuildArgs = map[string]string{"GO_VERSION": "1.25.0"}
+		}, nil},
+		{"invalid build args", func(options *CreateOptions) {
+			options.BuildArgs = map[string]string{"GO_VERSION": "", "NODE_MAJOR": "22", "TARGETARCH": "arm64"}
+		}, []string{"build_args.GO_VERSION", "build_args.NODE_MAJOR", "build_args.TARGETARCH"}},
+		{"build args of a Dockerfile declaring none", func(options *CreateOptions) {
+			options.DockerfileName = "plain.Dockerfile"
+			options.BuildArgs = map[string]string{"GO_VERSION": "1.25.0"}
+		}, []string{"build_args.GO_VERSION"}},
+		{"invalid port and on_busy", func(options *CreateOptions) {
+			options.HTTPPort = "70000"
+			options.OnBusy = "retry"
+		}, []string{"http_port", "on_busy"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			options := valid
+			test.change(&options)
+			fields := invalidFields(t, engine.ValidateCreate(options))
+			if !slices.Equal(fields, test.fields) {
+				t.Errorf("invalid fields = %q, want %q", fields, test.fields)
+			}
+		})
+	}
+}
+
+func TestValidateWorkspace(t *testing.T) {
+	tests := []struct {
+		projectsDirectory string
+		workspaceName     string
+		fields            []string
+	}{
+		{"projects", "ws1", nil},
+		{"/home/bob/projects", "my_workspace.2", nil},
+		{"", "", []string{"projects_directory", "workspace_name"}},
+		{"projects/../..", "ws1", []string{"projects_directory"}},
+		{"/", "ws1", []string{"projects_directory"}},
+		{"projects", "../ws1", []string{"workspace_name"}},
+		{"projects", ".ws1", []string{"workspace_name"}},
+		{"projects\n", "ws 1", []string{"projects_directory", "workspace_name"}},
+	}
+	for _, test := range tests {
+		fields := invalidFields(t, ValidateWorkspace(test.projectsDirectory, test.workspaceName))
+		if !slices.Equal(fields, test.fields) {
+			t.Errorf("ValidateWorkspace(%q, %q): invalid fields = %q, want %q", test.projectsDirectory, test.workspaceName, fields, test.fields)
+		}
+	}
+}
+
+func TestBaseComposeFiles(t *testing.T) {
+	templates := t.TempDir()
+	for name, content := range map[string]string{
+		"compose.yml":         "services:\n  web-ide:\n    build: .\n",
+		"compose.dev.yaml":    "services:\n  web-ide:\n    build:\n      context: .\n  db:\n    image: postgres\n",
+		"compose.offload.yml": "models:\n  llm:\n    model: ai/qwen3\n",
+		"compose.image.yml":   "services:\n  web-ide:\n    image: gitpod/openvscode-server\n",
+	} {
+		if err := os.WriteFile(filepath.Join(templates, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	engine := NewEngine(WithTemplatesDirectory(templates))
+	base, err := engine.BaseComposeFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"compose.dev.yaml", "compose.yml"}; !slices.Equal(base, want) {
+		t.Errorf("BaseComposeFiles() = %q, want %q", base, want)
+	}
+	overrides, err := engine.OverrideComposeFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"compose.image.yml", "compose.offload.yml"}; !slices.Equal(overrides, want) {
+		t.Errorf("OverrideComposeFiles() = %q, want %q", overrides, want)
+	}
+}
+
+func TestValidateKnownHost(t *testing.T) {
+	tests := []struct {
+		host   string
+		port   string
+		fields []string
+	}{
+		{"github.com", "", nil},
+		{"192.168.1.10", "2222", nil},
+		{"", "", []string{"host"}},
+		{"-oProxyCommand=touch", "", []string{"host"}},
+		{"github.com evil.com", "", []string{"host"}},
+		{"gitlab.example.com", "ssh", []string{"port"}},
+		{"gitlab.example.com", "0", []string{"port"}},
+		{"-v", "70000", []string{"host", "port"}},
+	}
+	for _, test := range tests {
+		fields := invalidFields(t, ValidateKnownHost(test.host, test.port))
+		if !slices.Equal(fields, test.fields) {
+			t.Errorf("ValidateKnownHost(%q, %q): invalid fields = %q, want %q", test.host, test.port, fields, test.fields)
+		}
+	}
+}
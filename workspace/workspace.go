@@ -0,0 +1,272 @@
+// Package workspace implements the lifecycle of a Compose Codex workspace:
+// create (directory layout, git configuration, clone, templates), start,
+// stop and remove. The MCP tools of the server are thin wrappers around it.
+package workspace
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Engine runs the workspace operations.
+// It knows where the templates (Dockerfiles and compose files) and the SSH keys live.
+type Engine struct {
+	TemplatesDirectory string // directory containing the *.Dockerfile and compose files, overriding the ones of TemplatesFS
+	TemplatesFS        fs.FS  // default templates, e.g. embedded in the executable
+	SSHDirectory       string // directory containing the user's SSH keys
+	SSHAgentSocket     string // SSH agent socket mounted in the web IDE with the agent mode
+	KnownHostsFile     string // trusted SSH host keys, copied into the workspaces
+	JobsDirectory      string // history of the background jobs, see Jobs
+	PortsFile          string // reservation table of the HTTP ports of the workspaces
+	PortRangeStart     int    // range of the HTTP ports allocated to the workspaces
+	PortRangeEnd       int
+	TrashFile          string        // index of the removed workspaces kept in the trash
+	TrashRetention     time.Duration // how long a removed workspace stays in the trash, 0 to delete at once
+
+	knownHostsMutex sync.Mutex
+	portsMutex      sync.Mutex
+	trashMutex      sync.Mutex
+	locksMutex      sync.Mutex
+	locks           map[string]*workspaceLock // by workspace directory, see lock
+}
+
+type EngineOption func(*Engine)
+
+// NewEngine creates an engine with the templates read from the current directory,
+// the SSH keys read from $HOME/.ssh, the SSH agent of $SSH_AUTH_SOCK, the HTTP ports allocated from 8100-8199,
+// the removed workspaces kept 7 days in the trash, and the known hosts, the jobs, the ports and the trash index
+// stored in the user configuration directory, unless overridden by the options.
+func NewEngine(options ...EngineOption) *Engine {
+	engine := &Engine{
+		TemplatesDirectory: ".",
+		SSHAgentSocket:     defaultSSHAgentSocket(),
+		PortRangeStart:     8100,
+		PortRangeEnd:       8199,
+		TrashRetention:     7 * 24 * time.Hour,
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		engine.SSHDirectory = filepath.Join(home, ".ssh")
+	}
+	engine.KnownHostsFile = "known_hosts"
+	engine.JobsDirectory = "jobs"
+	engine.PortsFile = "ports.json"
+	engine.TrashFile = "trash.json"
+	if config, err := os.UserConfigDir(); err == nil {
+		engine.KnownHostsFile = filepath.Join(config, "compose-codex", "known_hosts")
+		engine.JobsDirectory = filepath.Join(config, "compose-codex", "jobs")
+		engine.PortsFile = filepath.Join(config, "compose-codex", "ports.json")
+		engine.TrashFile = filepath.Join(config, "compose-codex", "trash.json")
+	}
+	// Apply all options
+	for _, option := range options {
+		option(engine)
+	}
+	return engine
+}
+
+func WithTemplatesDirectory(directory string) EngineOption {
+	return func(e *Engine) {
+		e.TemplatesDirectory = directory
+	}
+}
+
+// WithTemplatesFS sets the default templates. The templates of the templates directory override them.
+func WithTemplatesFS(templates fs.FS) EngineOption {
+	return func(e *Engine) {
+		e.TemplatesFS = templates
+	}
+}
+
+func WithSSHDirectory(directory string) EngineOption {
+	return func(e *Engine) {
+		e.SSHDirectory = directory
+	}
+}
+
+func WithSSHAgentSocket(socket string) EngineOption {
+	return func(e *Engine) {
+		e.SSHAgentSocket = socket
+	}
+}
+
+func WithKnownHostsFile(path string) EngineOption {
+	return func(e *Engine) {
+		e.KnownHostsFile = path
+	}
+}
+
+func WithJobsDirectory(directory string) EngineOption {
+	return func(e *Engine) {
+		e.JobsDirectory = directory
+	}
+}
+
+func WithPortsFile(path string) EngineOption {
+	return func(e *Engine) {
+		e.PortsFile = path
+	}
+}
+
+// WithPortRange sets the range (inclusive) of the HTTP ports allocated to the workspaces.
+func WithPortRange(start, end int) EngineOption {
+	return func(e *Engine) {
+		e.PortRangeStart = start
+		e.PortRangeEnd = end
+	}
+}
+
+// WithTrashFile sets the index of the trash.
+func WithTrashFile(path string) EngineOption {
+	return func(e *Engine) {
+		e.TrashFile = path
+	}
+}
+
+// WithTrashRetention sets how long a removed workspace stays in the trash.
+// With 0, the removed workspaces are deleted at once.
+func WithTrashRetention(retention time.Duration) EngineOption {
+	return func(e *Engine) {
+		e.TrashRetention = retention
+	}
+}
+
+// Dir returns the directory of a workspace.
+func (e *Engine) Dir(projectsDirectory, workspaceName string) string {
+	return filepath.Join(projectsDirectory, workspaceName)
+}
+
+// ProjectName returns the name of the repository cloned into the workspace,
+// that is the first non hidden directory of <workspace>/workspace.
+func (e *Engine) ProjectName(projectsDirectory, workspaceName string) string {
+	entries, err := os.ReadDir(filepath.Join(e.Dir(projectsDirectory, workspaceName), "workspace"))
+	if err != nil {
+		return ""
+	}
+	for _, entry := range entries {
+		if entry.IsDir() && !strings.HasPrefix(entry.Name(), ".") {
+			return entry.Name()
+		}
+	}
+	return ""
+}
+
+// AccessURL returns the URL of the web IDE, opened on the cloned project.
+func AccessURL(httpPort, projectName string) string {
+	return fmt.Sprintf("http://localhost:%s/?folder=/home/workspace/%s", httpPort, projectName)
+}
+
+type StepStatus string
+
+const (
+	StepDone      StepStatus = "done"
+	StepFailed    StepStatus = "failed"
+	StepCancelled StepStatus = "cancelled" // the operation was cancelled before or during the step
+)
+
+// Step is one unit of work of an operation (e.g. "clone_repository").
+type Step struct {
+	Name    string     `json:"name"`
+	Status  StepStatus `json:"status"`
+	Message string     `json:"message,omitempty"`
+	Output  string     `json:"output,omitempty"` // output of the external command, if any
+}
+
+// Result is the step by step report of an operation.
+// It is returned even when the operation fails, the last step being the failed one.
+type Result struct {
+	Action    string        `json:"action"`
+	Workspace string        `json:"workspace"`
+	Steps     []Step        `json:"steps"`
+	AccessURL string        `json:"access_url,omitempty"`
+	PublicKey string        `json:"public_key,omitempty"` // deploy key generated for the workspace
+	Reclaimed *RemoveReport `json:"reclaimed,omitempty"`  // what a remove deleted
+	Trashed   *TrashEntry   `json:"trashed,omitempty"`    // where a remove moved the workspace
+
+	tracker *tracker        // reports the steps while they run, see WithReporter
+	ctx     context.Context // no step starts once it is done
+}
+
+// do runs fn as the named step and records its outcome.
+// fn can fill the message and the output of the step.
+// The step is not run when the operation is cancelled.
+func (r *Result) do(name string, fn func(step *Step) error) error {
+	step := Step{Name: name}
+	if r.tracker != nil {
+		r.tracker.start(name)
+	}
+	var err error
+	if r.ctx != nil && r.ctx.Err() != nil {
+		err = cancelError(r.ctx)
+	} else {
+		err = fn(&step)
+	}
+	if err != nil {
+		step.Status = StepFailed
+		if errors.Is(err, ErrCancelled) {
+			step.Status = StepCancelled
+		}
+		if step.Message == "" {
+			step.Message = err.Error()
+		}
+	} else {
+		step.Status = StepDone
+	}
+	r.Steps = append(r.Steps, step)
+	if r.tracker != nil {
+		r.tracker.end(step)
+	}
+	if err != nil {
+		return &StepError{Step: name, Err: err}
+	}
+	return nil
+}
+
+// rollback runs fn as the named step undoing the work of a cancelled operation.
+// It runs whatever the state of the context of the operation, its failure is only recorded.
+func (r *Result) rollback(name string, fn func(step *Step) error) {
+	step := Step{Name: name, Status: StepDone}
+	if err := fn(&step); err != nil {
+		step.Status = StepFailed
+		step.Message = fmt.Sprintf("%s (%v)", step.Message, err)
+	}
+	r.Steps = append(r.Steps, step)
+}
+
+// String renders the result as a human readable report.
+func (r *Result) String() string {
+	var builder strings.Builder
+	for _, step := range r.Steps {
+		icon := "✅"
+		switch step.Status {
+		case StepFailed:
+			icon = "❌"
+		case StepCancelled:
+			icon = "🛑"
+		}
+		fmt.Fprintf(&builder, "%s %s: %s\n", icon, step.Name, step.Message)
+		if step.Output != "" {
+			fmt.Fprintf(&builder, "%s\n", strings.TrimRight(step.Output, "\n"))
+		}
+	}
+	if r.PublicKey != "" {
+		fmt.Fprintf(&builder, "\nAdd this deploy key to the repository (with write access to push):\n%s", r.PublicKey)
+	}
+	if r.AccessURL != "" {
+		fmt.Fprintf(&builder, "\nAccess the web IDE at %s\n", r.AccessURL)
+	}
+	if r.Trashed != nil {
+		fmt.Fprintf(&builder, "\nThe workspace is in the trash until %s: restore it with restore_workspace (trash_id %s), or delete it now with purge_trash.\n",
+			r.Trashed.ExpiresAt.Format(time.DateTime), r.Trashed.ID)
+	}
+	if r.Reclaimed != nil {
+		fmt.Fprintf(&builder, "\n%s", r.Reclaimed)
+	}
+	return builder.String()
+}
@@ -0,0 +1,143 @@
+package workspace
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestResultDo(t *testing.T) {
+	failure := errors.New("git clone failed")
+	tests := []struct {
+		name    string
+		fn      func(step *Step) error
+		want    Step
+		wantErr error
+	}{
+		{
+			name: "done",
+			fn: func(step *Step) error {
+				step.Message = "Repository cloned"
+				step.Output = "Cloning into 'project'..."
+				return nil
+			},
+			want: Step{Name: "clone_repository", Status: StepDone, Message: "Repository cloned", Output: "Cloning into 'project'..."},
+		},
+		{
+			name: "failed with the error as message",
+			fn: func(step *Step) error {
+				return failure
+			},
+			want:    Step{Name: "clone_repository", Status: StepFailed, Message: failure.Error()},
+			wantErr: failure,
+		},
+		{
+			name: "failed with its message",
+			fn: func(step *Step) error {
+				step.Message = "Failed to clone the repository"
+				return failure
+			},
+			want:    Step{Name: "clone_repository", Status: StepFailed, Message: "Failed to clone the repository"},
+			wantErr: failure,
+		},
+		{
+			name: "cancelled",
+			fn: func(step *Step) error {
+				step.Message = "Clone cancelled"
+				ctx, cancel := context.WithCancel(context.Background())
+				cancel()
+				return cancelError(ctx)
+			},
+			want:    Step{Name: "clone_repository", Status: StepCancelled, Message: "Clone cancelled"},
+			wantErr: ErrCancelled,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result := &Result{Action: "create", Workspace: "ws1"}
+			err := result.do("clone_repository", test.fn)
+			if test.wantErr == nil && err != nil {
+				t.Fatalf("do: %v", err)
+			}
+			if test.wantErr != nil {
+				var stepError *StepError
+				if !errors.As(err, &stepError) || stepError.Step != "clone_repository" || !errors.Is(err, test.wantErr) {
+					t.Fatalf("do = %v, want a *StepError wrapping %v", err, test.wantErr)
+				}
+			}
+			if len(result.Steps) != 1 || result.Steps[0] != test.want {
+				t.Errorf("Steps = %+v, want [%+v]", result.Steps, test.want)
+			}
+		})
+	}
+}
+
+// The steps are reported in the order they ran, the last one being the failed one.
+func TestResultSteps(t *testing.T) {
+	result := &Result{Action: "create", Workspace: "ws1"}
+	result.do("initialize_workspace", func(step *Step) error { return nil })
+	result.do("copy_templates", func(step *Step) error { return errors.New("compose.yml not found") })
+
+	if len(result.Steps) != 2 {
+		t.Fatalf("Steps = %+v, want 2 steps", result.Steps)
+	}
+	if step := result.Steps[0]; step.Name != "initialize_workspace" || step.Status != StepDone {
+		t.Errorf("first step = %+v, want initialize_workspace done", step)
+	}
+	if step := result.Steps[1]; step.Name != "copy_templates" || step.Status != StepFailed || step.Message != "compose.yml not found" {
+		t.Errorf("last step = %+v, want copy_templates failed", step)
+	}
+}
+
+func TestResultDoCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	result, ctx := newResult(ctx, "start", "ws1", 2)
+	if err := result.do("check_workspace", func(step *Step) error { return nil }); err != nil {
+		t.Fatalf("do: %v", err)
+	}
+	cancel()
+	ran := false
+	err := result.do("compose_up", func(step *Step) error {
+		ran = true
+		return nil
+	})
+	if ran {
+		t.Error("the step ran after the cancellation of the operation")
+	}
+	if !errors.Is(err, ErrCancelled) || !errors.Is(err, context.Canceled) {
+		t.Errorf("do = %v, want %v", err, ErrCancelled)
+	}
+	want := []StepStatus{StepDone, StepCancelled}
+	if len(result.Steps) != len(want) {
+		t.Fatalf("Steps = %+v, want %d steps", result.Steps, len(want))
+	}
+	for i, step := range result.Steps {
+		if step.Status != want[i] {
+			t.Errorf("step %s is %s, want %s", step.Name, step.Status, want[i])
+		}
+	}
+}
+
+func TestResultRollback(t *testing.T) {
+	result, _ := newResult(context.Background(), "start", "ws1", 1)
+	result.rollback("rollback", func(step *Step) error {
+		step.Message = "Containers removed"
+		return nil
+	})
+	result.rollback("rollback", func(step *Step) error {
+		step.Message = "Containers not removed"
+		return errors.New("docker compose down failed")
+	})
+	want := []Step{
+		{Name: "rollback", Status: StepDone, Message: "Containers removed"},
+		{Name: "rollback", Status: StepFailed, Message: "Containers not removed (docker compose down failed)"},
+	}
+	if len(result.Steps) != len(want) {
+		t.Fatalf("Steps = %+v, want %+v", result.Steps, want)
+	}
+	for i := range want {
+		if result.Steps[i] != want[i] {
+			t.Errorf("step %d = %+v, want %+v", i, result.Steps[i], want[i])
+		}
+	}
+}